@@ -16,38 +16,188 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
 
-	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/wot-oss/tmtd/internal/process"
 )
 
 // buildCmd represents the build command
 var buildCmd = &cobra.Command{
-	Use:   "build",
+	Use:   "build <file> | --manifest <file>",
 	Short: "create Thing Descriptions out of models",
+	Long: `create Thing Descriptions out of models.
+With --manifest all entries of a json or yaml manifest are built concurrently,
+every entry has a model, and optionally a varmap, inline vars and an output name:
+
+	entries:
+	  - model: dim.jsonld
+	    varmap: vars-kitchen.json
+	    vars:
+	      deviceId: kitchen-1
+	    output: kitchen-1.td.jsonld
+
+The command exits with 1 if an entry failed.
+With --watch the TDs are rebuilt whenever a file they are built from changes,
+the changes of every rebuilt TD are printed.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		if len(args) < 1 {
-			fmt.Println("file argument missing")
-		}
-		//p := &process.Processor{}
-		p := process.NewProcessor(cmd.Flag("outputDir").Value.String(),
-			cmd.Flag("searchPath").Value.String(),
-			cmd.Flag("varmap").Value.String())
-		err := p.Process(args[0])
+		manifest := cmd.Flag("manifest").Value.String()
+		if len(args) < 1 && manifest == "" {
+			fmt.Fprintln(os.Stderr, "file argument missing")
+			os.Exit(1)
+		}
+		p, err := newBuildProcessor(cmd)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		noValidate, _ := cmd.Flags().GetBool("no-validate")
+		workers, _ := cmd.Flags().GetInt("workers")
+		if watch, _ := cmd.Flags().GetBool("watch"); watch {
+			watchBuild(cmd, args, manifest, workers, !noValidate)
+			return
+		}
+		if manifest != "" {
+			buildManifest(p, manifest, workers, !noValidate, cmd.Flag("outputDir").Value.String() == "-")
+			return
+		}
+		err = p.Process(args[0])
 		if err != nil {
-			log.Fatal(err)
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if !noValidate {
+			err = p.Validate()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+		if err = p.Save(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
 		}
-		p.Save()
 	},
 }
 
+// newBuildProcessor creates a processor with the settings of the flags
+func newBuildProcessor(cmd *cobra.Command) (*process.Processor, error) {
+	p := process.NewProcessor(cmd.Flag("outputDir").Value.String(),
+		cmd.Flag("searchPath").Value.String())
+	offline, _ := cmd.Flags().GetBool("offline")
+	p.SetResolver(process.NewHTTPResolver(process.DefaultCacheDir(), offline))
+	if err := p.SetPlaceholderMap(cmd.Flag("varmap").Value.String()); err != nil {
+		return nil, err
+	}
+	maxDepth, _ := cmd.Flags().GetInt("max-depth")
+	p.SetMaxDepth(maxDepth)
+	noValidate, _ := cmd.Flags().GetBool("no-validate")
+	p.SetValidateModels(!noValidate)
+	drop, _ := cmd.Flags().GetStringSlice("drop")
+	p.SetDropOptional(drop)
+	if compact, _ := cmd.Flags().GetBool("compact"); compact {
+		p.SetIndent("")
+	} else {
+		p.SetIndent(cmd.Flag("indent").Value.String())
+	}
+	keepOrder, _ := cmd.Flags().GetBool("keep-order")
+	p.SetKeepOrder(keepOrder)
+	compress, _ := cmd.Flags().GetBool("compress-keys")
+	p.SetKeyCompression(compress)
+	err := p.SetFormat(cmd.Flag("format").Value.String())
+	if err != nil {
+		return nil, err
+	}
+	err = p.SetJSONLD(cmd.Flag("jsonld").Value.String())
+	if err != nil {
+		return nil, err
+	}
+	err = p.SetBinding(cmd.Flag("binding").Value.String())
+	if err != nil {
+		return nil, err
+	}
+	err = p.SetSubmodelMode(cmd.Flag("submodel-mode").Value.String())
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// watchBuild builds the file or the manifest and rebuilds the TDs
+// whenever the files they are built from change, until it is interrupted
+func watchBuild(cmd *cobra.Command, args []string, manifest string, workers int, validate bool) {
+	m := &process.Manifest{}
+	if manifest != "" {
+		var err error
+		if m, err = process.LoadManifest(manifest); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	} else {
+		m.Entries = []process.ManifestEntry{{Model: args[0]}}
+	}
+	var report io.Writer = os.Stdout
+	if cmd.Flag("outputDir").Value.String() == "-" {
+		report = os.Stderr
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err := process.Watch(ctx, m, func() (*process.Processor, error) { return newBuildProcessor(cmd) }, workers, validate, report)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// buildManifest builds the entries of a manifest and reports the
+// result of every entry, the report is written to stderr if the TDs
+// are written to stdout
+func buildManifest(p *process.Processor, filename string, workers int, validate bool, toStdout bool) {
+	m, err := process.LoadManifest(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	var report io.Writer = os.Stdout
+	if toStdout {
+		report = os.Stderr
+	}
+	results, err := p.BuildManifest(m, workers, validate)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", filename, err)
+		os.Exit(1)
+	}
+	if failed := process.WriteBatchReport(report, results); failed > 0 {
+		os.Exit(1)
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(buildCmd)
 
-	buildCmd.Flags().StringP("varmap", "m", "", "filename of a json mapfile for substituations")
+	buildCmd.Flags().StringP("varmap", "m", "", "filename of a json or yaml mapfile for substituations")
 	buildCmd.Flags().StringP("outputDir", "o", "", "directory for output of thing descriptions")
 	buildCmd.Flags().StringP("searchPath", "s", "", "list of directories for source files")
+	buildCmd.Flags().Bool("no-validate", false, "skip the validation of the models and the generated thing descriptions")
+	buildCmd.Flags().Bool("offline", false, "load remote models only from the cache")
+	buildCmd.Flags().String("submodel-mode", string(process.SubmodelFlatten), "representation of submodels, one of [flatten, link]")
+	buildCmd.Flags().Int("max-depth", process.DefaultMaxDepth, "maximum nesting of extended, sub- and referenced models")
+	buildCmd.Flags().StringSlice("drop", nil, "list of optional affordances to remove, e.g. '#/properties/status'")
+	buildCmd.Flags().String("indent", process.DefaultIndent, "indentation of the written thing descriptions")
+	buildCmd.Flags().Bool("compact", false, "write compact thing descriptions without whitespace")
+	buildCmd.Flags().Bool("keep-order", false, "keep the order of the members in the models")
+	buildCmd.Flags().StringP("format", "f", process.FormatJSON, "format of the thing descriptions, one of [json, yaml, cbor, ntriples, turtle]")
+	buildCmd.Flags().Bool("compress-keys", false, "write common TD terms as integers in cbor")
+	buildCmd.Flags().String("binding", "", "json or yaml binding template to generate missing forms")
+	buildCmd.Flags().String("manifest", "", "json or yaml manifest of the models to build instead of a file argument")
+	buildCmd.Flags().Int("workers", runtime.NumCPU(), "number of TDs built concurrently with --manifest")
+	buildCmd.Flags().Bool("watch", false, "rebuild the thing descriptions when the models or map files change")
+	buildCmd.Flags().String("jsonld", "", "write the JSON-LD form of the thing descriptions, one of [expand, compact]")
 
 }
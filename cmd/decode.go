@@ -0,0 +1,74 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wot-oss/tmtd/internal/process"
+)
+
+// decodeCmd represents the decode command
+var decodeCmd = &cobra.Command{
+	Use:   "decode <file>",
+	Short: "convert a binary (cbor) thing description to json",
+	Long: `convert a binary (cbor) thing description to json.
+The file - reads the thing description from stdin.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var content []byte
+		var err error
+		if args[0] == "-" {
+			content, err = io.ReadAll(os.Stdin)
+		} else {
+			content, err = os.ReadFile(args[0])
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		data, err := process.DecodeCBOR(content)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+			os.Exit(1)
+		}
+		enc := process.NewEncoder(cmd.Flag("indent").Value.String())
+		enc.SetKeepOrder(true)
+		out, err := enc.Encode(data)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if output := cmd.Flag("output").Value.String(); output != "" {
+			err = os.WriteFile(output, out, 0644)
+		} else {
+			_, err = os.Stdout.Write(out)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(decodeCmd)
+	decodeCmd.Flags().StringP("output", "o", "", "file for the json thing description, default stdout")
+	decodeCmd.Flags().String("indent", process.DefaultIndent, "indentation of the json thing description")
+}
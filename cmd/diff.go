@@ -0,0 +1,169 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/wot-oss/tmtd/internal/process"
+)
+
+// exitBreaking is the exit code of diff for breaking changes, errors
+// exit with 1 like in the other commands
+const exitBreaking = 2
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff <old> <new> | --from <rev> [--to <rev>] <model>",
+	Short: "compare two thing descriptions and classify the changes",
+	Long: `compare two thing descriptions and classify the changes.
+The properties, actions and events are compared with their schemas and forms,
+every change is either breaking, a consumer of the old TD may fail with the new
+one, or compatible. Thing models are built before they are compared.
+With --from the TDs built from the model at two git revisions are compared, the
+second revision is set with --to and defaults to the work tree. The search path,
+varmap and binding are taken from the same revision.
+The command exits with 0 if all changes are compatible, with 2 if a change is
+breaking and with 1 on errors, e.g. a model that can't be built.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		from := cmd.Flag("from").Value.String()
+		to := cmd.Flag("to").Value.String()
+		var oldTD, newTD *process.Object
+		var err error
+		switch {
+		case from != "" && len(args) == 1:
+			if oldTD, err = loadRevisionTD(cmd, args[0], from); err == nil {
+				newTD, err = loadRevisionTD(cmd, args[0], to)
+			}
+		case from == "" && to == "" && len(args) == 2:
+			if oldTD, err = loadTD(cmd, args[0], nil); err == nil {
+				newTD, err = loadTD(cmd, args[1], nil)
+			}
+		default:
+			err = fmt.Errorf("expected two files or --from and one model")
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		changes := process.CompareTDs(oldTD, newTD)
+		if err = process.WriteTDChanges(os.Stdout, cmd.Flag("format").Value.String(), changes); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if process.HasBreakingChanges(changes) {
+			os.Exit(exitBreaking)
+		}
+	},
+}
+
+// loadRevisionTD builds the model at the git revision rev, an empty
+// revision is the work tree
+func loadRevisionTD(cmd *cobra.Command, model string, rev string) (*process.Object, error) {
+	if rev == "" {
+		return loadTD(cmd, model, nil)
+	}
+	r, err := process.CheckoutRevision(".", rev)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	td, err := loadTD(cmd, model, r)
+	if err != nil {
+		return nil, fmt.Errorf("revision %s: %w", rev, err)
+	}
+	return td, nil
+}
+
+// loadTD reads a TD or builds a TD of a thing model. The files of a
+// revision are used instead of the work tree if rev is set.
+func loadTD(cmd *cobra.Command, filename string, rev *process.Revision) (*process.Object, error) {
+	searchPath := cmd.Flag("searchPath").Value.String()
+	varmap := cmd.Flag("varmap").Value.String()
+	binding := cmd.Flag("binding").Value.String()
+	if rev != nil {
+		filename = rev.Path(filename)
+		searchPath = rev.SearchPath(searchPath)
+		varmap = rev.Path(varmap)
+		binding = rev.Path(binding)
+	}
+	if _, err := os.Stat(filename); err == nil {
+		if filename, err = filepath.Abs(filename); err != nil {
+			return nil, err
+		}
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		data, err := process.ParseDocument(content, filename)
+		if err != nil {
+			return nil, err
+		}
+		if !process.IsThingModel(data) {
+			td, ok := data.(*process.Object)
+			if !ok {
+				return nil, fmt.Errorf("%s is not a thing description", filename)
+			}
+			return td, nil
+		}
+	}
+	p := process.NewProcessor("", searchPath)
+	offline, _ := cmd.Flags().GetBool("offline")
+	p.SetResolver(process.NewHTTPResolver(process.DefaultCacheDir(), offline))
+	if err := errors.Join(p.SetPlaceholderMap(varmap), p.SetBinding(binding)); err != nil {
+		return nil, err
+	}
+	if err := p.Process(filename); err != nil {
+		return nil, err
+	}
+	td := p.TD()
+	if rev != nil {
+		// the links to the models refer to the extracted files
+		for _, l := range asLinks(td.Value("links")) {
+			if href, ok := l.Value("href").(string); ok {
+				l.Set("href", rev.WorkTreePath(href))
+			}
+		}
+	}
+	return td, nil
+}
+
+func asLinks(v any) []*process.Object {
+	var links []*process.Object
+	list, _ := v.([]any)
+	for _, l := range list {
+		if link, ok := l.(*process.Object); ok {
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().StringP("searchPath", "s", "", "list of directories for source files")
+	diffCmd.Flags().StringP("varmap", "m", "", "filename of a json or yaml mapfile for the placeholders of the models")
+	diffCmd.Flags().String("binding", "", "json or yaml binding template to generate missing forms")
+	diffCmd.Flags().String("from", "", "git revision of the old model")
+	diffCmd.Flags().String("to", "", "git revision of the new model, default is the work tree")
+	diffCmd.Flags().StringP("format", "f", process.DiffFormatText, "output format, one of [text, json]")
+	diffCmd.Flags().Bool("offline", false, "load remote models only from the cache")
+}
@@ -0,0 +1,71 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wot-oss/tmtd/internal/process"
+)
+
+// graphCmd represents the graph command
+var graphCmd = &cobra.Command{
+	Use:   "graph [<model>...]",
+	Short: "print the dependency graph of thing models",
+	Long: `print the dependency graph of thing models.
+The edges are the tm:extends and tm:submodel links and the tm:ref references to
+other files, submodel edges are labeled with the instance name and references with
+the JSON pointer. With --all the graph contains all models of the search path,
+including models without dependencies.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		searchPath := cmd.Flag("searchPath").Value.String()
+		models := args
+		if all, _ := cmd.Flags().GetBool("all"); all {
+			models = append(models, process.CatalogueModels(searchPath)...)
+		}
+		if len(models) == 0 {
+			fmt.Fprintln(os.Stderr, "model argument missing, or use --all")
+			os.Exit(1)
+		}
+		p := process.NewProcessor("", searchPath)
+		offline, _ := cmd.Flags().GetBool("offline")
+		p.SetResolver(process.NewHTTPResolver(process.DefaultCacheDir(), offline))
+		if err := p.SetPlaceholderMap(cmd.Flag("varmap").Value.String()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		maxDepth, _ := cmd.Flags().GetInt("max-depth")
+		p.SetMaxDepth(maxDepth)
+		g := p.Graph(models)
+		if err := process.WriteGraph(os.Stdout, cmd.Flag("format").Value.String(), g); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(graphCmd)
+
+	graphCmd.Flags().StringP("searchPath", "s", "", "list of directories for source files")
+	graphCmd.Flags().StringP("varmap", "m", "", "filename of a json or yaml mapfile for the placeholders of the models")
+	graphCmd.Flags().Bool("all", false, "include all models of the search path")
+	graphCmd.Flags().StringP("format", "f", process.GraphFormatDOT, "output format, one of [dot, mermaid, json]")
+	graphCmd.Flags().Bool("offline", false, "load remote models only from the cache")
+	graphCmd.Flags().Int("max-depth", process.DefaultMaxDepth, "maximum nesting of extended, sub- and referenced models")
+}
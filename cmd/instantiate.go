@@ -0,0 +1,143 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+
+	"github.com/spf13/cobra"
+	"github.com/wot-oss/tmtd/internal/process"
+)
+
+// instantiateCmd represents the instantiate command
+var instantiateCmd = &cobra.Command{
+	Use:   "instantiate -m <model> --devices <file>",
+	Short: "create a Thing Description per device of a device list",
+	Long: `create a Thing Description per device of a device list.
+The device list is a CSV file with a header row or a JSONL file with a JSON object
+per line, the values of a device replace the placeholders of the model. The header
+location.room of a CSV file sets the nested value {{location.room}}, CSV values are
+strings and are converted by typed placeholders like {{port:integer}}.
+The file names of the TDs are created from --name, e.g. '{{location.room}}-{{id}}.td.jsonld'.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		outputDir := cmd.Flag("outputDir").Value.String()
+		array := cmd.Flag("array").Value.String()
+		index, _ := cmd.Flags().GetBool("index")
+		if outputDir == "" && array == "" {
+			fmt.Fprintln(os.Stderr, "set the output directory or --array")
+			os.Exit(1)
+		}
+		if index && (outputDir == "" || outputDir == "-") {
+			fmt.Fprintln(os.Stderr, "--index requires an output directory")
+			os.Exit(1)
+		}
+		p := process.NewProcessor(outputDir, cmd.Flag("searchPath").Value.String())
+		offline, _ := cmd.Flags().GetBool("offline")
+		p.SetResolver(process.NewHTTPResolver(process.DefaultCacheDir(), offline))
+		maxDepth, _ := cmd.Flags().GetInt("max-depth")
+		p.SetMaxDepth(maxDepth)
+		p.SetIndent(cmd.Flag("indent").Value.String())
+		format := cmd.Flag("format").Value.String()
+		if array != "" && format != process.FormatJSON {
+			fmt.Fprintln(os.Stderr, "--array requires the format json")
+			os.Exit(1)
+		}
+		err := errors.Join(p.SetPlaceholderMap(cmd.Flag("varmap").Value.String()),
+			p.SetFormat(format), p.SetBinding(cmd.Flag("binding").Value.String()))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		devices, err := process.LoadDevices(cmd.Flag("devices").Value.String())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		nameTemplate := cmd.Flag("name").Value.String()
+		if nameTemplate == "" {
+			nameTemplate = "{{id}}.td" + process.FormatExtension(format)
+		}
+		m, err := process.DeviceManifest(cmd.Flag("model").Value.String(), devices, nameTemplate)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		workers, _ := cmd.Flags().GetInt("workers")
+		noValidate, _ := cmd.Flags().GetBool("no-validate")
+		results, err := p.BuildManifest(m, workers, !noValidate)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "name template %s: %v\n", nameTemplate, err)
+			os.Exit(1)
+		}
+		var report io.Writer = os.Stdout
+		if outputDir == "-" || array == "-" {
+			report = os.Stderr
+		}
+		failed := process.WriteBatchReport(report, results)
+		if array != "" {
+			out := os.Stdout
+			if array != "-" {
+				if out, err = os.Create(array); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+				defer out.Close()
+			}
+			err = process.WriteTDArray(out, results, cmd.Flag("indent").Value.String())
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+		if index {
+			if err := process.WriteDeviceIndex(outputDir, results); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+		if failed > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(instantiateCmd)
+
+	instantiateCmd.Flags().StringP("model", "m", "", "thing model to instantiate")
+	instantiateCmd.Flags().String("devices", "", "CSV or JSONL file with the placeholder values of a device per row")
+	instantiateCmd.Flags().String("name", "", "file name template of the TDs, default '{{id}}.td.jsonld'")
+	instantiateCmd.Flags().String("varmap", "", "filename of a json or yaml mapfile with the values common to all devices")
+	instantiateCmd.Flags().StringP("outputDir", "o", "", "directory for output of thing descriptions")
+	instantiateCmd.Flags().String("array", "", "write all thing descriptions as one JSON array to a file, '-' for stdout")
+	instantiateCmd.Flags().Bool("index", false, "write an index.json of the TDs to the output directory")
+	instantiateCmd.Flags().StringP("searchPath", "s", "", "list of directories for source files")
+	instantiateCmd.Flags().Bool("no-validate", false, "skip the validation of the models and the generated thing descriptions")
+	instantiateCmd.Flags().Bool("offline", false, "load remote models only from the cache")
+	instantiateCmd.Flags().Int("max-depth", process.DefaultMaxDepth, "maximum nesting of extended, sub- and referenced models")
+	instantiateCmd.Flags().String("indent", process.DefaultIndent, "indentation of the written thing descriptions")
+	instantiateCmd.Flags().StringP("format", "f", process.FormatJSON, "format of the thing descriptions, one of [json, yaml, cbor, ntriples, turtle]")
+	instantiateCmd.Flags().String("binding", "", "json or yaml binding template to generate missing forms")
+	instantiateCmd.Flags().Int("workers", runtime.NumCPU(), "number of TDs built concurrently")
+	_ = instantiateCmd.MarkFlagRequired("model")
+	_ = instantiateCmd.MarkFlagRequired("devices")
+}
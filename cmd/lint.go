@@ -0,0 +1,86 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/wot-oss/tmtd/internal/config"
+	"github.com/wot-oss/tmtd/internal/process"
+)
+
+// lintCmd represents the lint command
+var lintCmd = &cobra.Command{
+	Use:   "lint [<file>...]",
+	Short: "check thing models for problems before transpiling",
+	Long: `check thing models for problems before transpiling.
+Without files all jsonld files in the search path are checked.
+Rules are disabled by ID or name with --disable or the config key lintDisabledRules.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if ok, _ := cmd.Flags().GetBool("rules"); ok {
+			for _, r := range process.LintRules {
+				fmt.Printf("%s %-24s %-8s %s\n", r.ID, r.Name, r.Severity, r.Description)
+			}
+			return
+		}
+		format := cmd.Flag("format").Value.String()
+		offline, _ := cmd.Flags().GetBool("offline")
+		disabled, _ := cmd.Flags().GetStringSlice("disable")
+		disabled = append(disabled, viper.GetStringSlice(config.KeyLintDisabledRules)...)
+
+		linter := process.NewLinter(cmd.Flag("searchPath").Value.String(),
+			process.NewHTTPResolver(process.DefaultCacheDir(), offline), disabled)
+		files := args
+		if len(files) == 0 {
+			var err error
+			files, err = linter.Files()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+		findings := make([]process.Finding, 0)
+		failed := false
+		for _, filename := range files {
+			f, err := linter.Lint(filename)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				failed = true
+				continue
+			}
+			findings = append(findings, f...)
+		}
+		if err := process.WriteFindings(os.Stdout, format, findings); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if failed || process.HasErrors(findings) {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lintCmd)
+	lintCmd.Flags().StringP("searchPath", "s", "", "list of directories for source files")
+	lintCmd.Flags().StringP("format", "f", process.LintFormatText, "output format: text, json or sarif")
+	lintCmd.Flags().StringSlice("disable", nil, "rule IDs or names to disable")
+	lintCmd.Flags().Bool("offline", false, "use only cached copies of remote models")
+	lintCmd.Flags().Bool("rules", false, "print the rule catalogue")
+}
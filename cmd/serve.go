@@ -0,0 +1,149 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/wot-oss/tmtd/internal/config"
+	"github.com/wot-oss/tmtd/internal/process"
+	"github.com/wot-oss/tmtd/internal/server"
+)
+
+// shutdownTimeout is the time running requests get to finish on shutdown
+const shutdownTimeout = 10 * time.Second
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "serve an HTTP API to build and validate thing descriptions",
+	Long: `serve an HTTP API to build and validate thing descriptions.
+
+	POST /build               build the TD of {"model": <thing model or name>, "vars": {...}}
+	GET  /models              list the models of the search path
+	GET  /models/{name}/td    build the TD of a model, ?var=name=value sets placeholders
+	POST /validate            validate a TD or TM
+
+The build endpoints accept the query parameters format, jsonld and validate=false.
+Posted models may only reference files of the search path with relative hrefs
+without '..', --allow-file-hrefs and --allow-remote-hrefs lift the restriction.
+The context root and CORS are set with flags or the config keys urlContextRoot,
+corsAllowedOrigins, corsAllowedHeaders, corsAllowCredentials and corsMaxAge.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		offline, _ := cmd.Flags().GetBool("offline")
+		maxDepth, _ := cmd.Flags().GetInt("max-depth")
+		allowFiles, _ := cmd.Flags().GetBool("allow-file-hrefs")
+		allowRemote, _ := cmd.Flags().GetBool("allow-remote-hrefs")
+		s, err := server.NewServer(server.Options{
+			SearchPath:  cmd.Flag("searchPath").Value.String(),
+			VarMap:      cmd.Flag("varmap").Value.String(),
+			Offline:     offline,
+			Binding:     cmd.Flag("binding").Value.String(),
+			MaxDepth:    maxDepth,
+			ContextRoot: viper.GetString(config.KeyUrlContextRoot),
+			Cors: server.CorsOptions{
+				AllowedOrigins:   listValue(config.KeyCorsAllowedOrigins),
+				AllowedHeaders:   listValue(config.KeyCorsAllowedHeaders),
+				AllowCredentials: viper.GetBool(config.KeyCorsAllowCredentials),
+				MaxAge:           viper.GetInt(config.KeyCorsMaxAge),
+			},
+			PostedHrefs: process.HrefRestriction{AllowFiles: allowFiles, AllowRemote: allowRemote},
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		port, _ := cmd.Flags().GetInt("port")
+		srv := &http.Server{
+			Addr:              net.JoinHostPort(cmd.Flag("host").Value.String(), strconv.Itoa(port)),
+			Handler:           s.Handler(),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		errCh := make(chan error, 1)
+		go func() {
+			slog.Info("starting server", "address", srv.Addr)
+			errCh <- srv.ListenAndServe()
+		}()
+		select {
+		case err := <-errCh:
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		case <-ctx.Done():
+		}
+		slog.Info("shutting down server")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	},
+}
+
+// listValue reads a list from the config, environment variables hold
+// comma separated values
+func listValue(key string) []string {
+	var values []string
+	for _, v := range viper.GetStringSlice(key) {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				values = append(values, s)
+			}
+		}
+	}
+	return values
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().String("host", "127.0.0.1", "host name or IP address to listen on, 0.0.0.0 for all interfaces")
+	serveCmd.Flags().IntP("port", "p", 8080, "port to listen on")
+	serveCmd.Flags().StringP("varmap", "m", "", "filename of a json or yaml mapfile for substituations")
+	serveCmd.Flags().StringP("searchPath", "s", "", "list of directories for source files")
+	serveCmd.Flags().Bool("offline", false, "load remote models only from the cache")
+	serveCmd.Flags().Int("max-depth", process.DefaultMaxDepth, "maximum nesting of extended, sub- and referenced models")
+	serveCmd.Flags().String("binding", "", "json or yaml binding template to generate missing forms")
+	serveCmd.Flags().Bool("allow-file-hrefs", false, "allow posted models to load files outside of the search path")
+	serveCmd.Flags().Bool("allow-remote-hrefs", false, "allow posted models to load http and https URLs")
+	serveCmd.Flags().String("urlContextRoot", "", "path prefix of the endpoints, e.g. /api")
+	serveCmd.Flags().StringSlice("corsAllowedOrigins", nil, "origins allowed to call the API, '*' allows all")
+	serveCmd.Flags().StringSlice("corsAllowedHeaders", nil, "additional request headers allowed for CORS")
+	serveCmd.Flags().Bool("corsAllowCredentials", false, "allow credentials in CORS requests")
+	serveCmd.Flags().Int("corsMaxAge", 0, "seconds a CORS preflight response may be cached")
+
+	_ = viper.BindPFlag(config.KeyUrlContextRoot, serveCmd.Flags().Lookup("urlContextRoot"))
+	_ = viper.BindPFlag(config.KeyCorsAllowedOrigins, serveCmd.Flags().Lookup("corsAllowedOrigins"))
+	_ = viper.BindPFlag(config.KeyCorsAllowedHeaders, serveCmd.Flags().Lookup("corsAllowedHeaders"))
+	_ = viper.BindPFlag(config.KeyCorsAllowCredentials, serveCmd.Flags().Lookup("corsAllowCredentials"))
+	_ = viper.BindPFlag(config.KeyCorsMaxAge, serveCmd.Flags().Lookup("corsMaxAge"))
+}
@@ -30,6 +30,7 @@ const (
 	KeyCorsAllowedHeaders   = "corsAllowedHeaders"
 	KeyCorsAllowCredentials = "corsAllowCredentials"
 	KeyCorsMaxAge           = "corsMaxAge"
+	KeyLintDisabledRules    = "lintDisabledRules"
 	EnvPrefix               = "tmtd"
 	LogLevelOff             = "off"
 )
@@ -73,4 +74,5 @@ func InitViper() {
 	_ = viper.BindEnv(KeyCorsAllowedHeaders)   // env variable name = tmtd_corsallowedheaders
 	_ = viper.BindEnv(KeyCorsAllowCredentials) // env variable name = tmtd_corsallowcredentials
 	_ = viper.BindEnv(KeyCorsMaxAge)           // env variable name = tmtd_corsmaxage
+	_ = viper.BindEnv(KeyLintDisabledRules)    // env variable name = tmtd_lintdisabledrules
 }
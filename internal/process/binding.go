@@ -0,0 +1,359 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+const (
+	ProtocolHTTP   = "http"
+	ProtocolCoAP   = "coap"
+	ProtocolMQTT   = "mqtt"
+	ProtocolModbus = "modbus"
+)
+
+// Binding is a protocol binding template. It generates the forms of
+// affordances without forms and the base of the TD. The templates may
+// contain placeholders, which are substituted with the values of the
+// placeholder map and these variables:
+//
+//	affordance      name of the affordance in its model
+//	name            name of the affordance in the TD, with the instance prefix of flattened submodels
+//	affordanceType  property, action or event
+//	section         properties, actions or events
+//	instance        instance names of the submodel, separated by /, not set for the TD itself
+//
+// Values in a map of the placeholder map named like the affordance
+// override the global values, e.g. the register address of a property.
+type Binding struct {
+	Protocol    string
+	Base        string
+	Href        string
+	ContentType string
+	// form template of each operation, an operation without template gets no form
+	Operations map[string]*Object
+	// prefixes of the protocol vocabulary, added to the @context
+	Context *Object
+	// Modbus register map, relative to the binding template
+	RegisterMap string
+	registers   map[string]*modbusRegister
+}
+
+// bindingDefaults are the templates of the supported protocols
+var bindingDefaults = map[string]func() *Binding{
+	ProtocolHTTP: func() *Binding {
+		return &Binding{
+			Href:        "{{section}}/{{name}}",
+			ContentType: "application/json",
+			Operations: map[string]*Object{
+				"readproperty":    formTemplate("htv:methodName", "GET"),
+				"writeproperty":   formTemplate("htv:methodName", "PUT"),
+				"observeproperty": formTemplate("htv:methodName", "GET", "subprotocol", "longpoll"),
+				"invokeaction":    formTemplate("htv:methodName", "POST"),
+				"subscribeevent":  formTemplate("htv:methodName", "GET", "subprotocol", "longpoll"),
+			},
+			Context: formTemplate("htv", "http://www.w3.org/2011/http#"),
+		}
+	},
+	ProtocolCoAP: func() *Binding {
+		return &Binding{
+			Href:        "{{section}}/{{name}}",
+			ContentType: "application/json",
+			Operations: map[string]*Object{
+				"readproperty":      formTemplate("cov:method", "GET"),
+				"writeproperty":     formTemplate("cov:method", "PUT"),
+				"observeproperty":   formTemplate("cov:method", "GET", "subprotocol", "cov:observe"),
+				"unobserveproperty": formTemplate("cov:method", "GET", "subprotocol", "cov:observe"),
+				"invokeaction":      formTemplate("cov:method", "POST"),
+				"subscribeevent":    formTemplate("cov:method", "GET", "subprotocol", "cov:observe"),
+				"unsubscribeevent":  formTemplate("cov:method", "GET", "subprotocol", "cov:observe"),
+			},
+			Context: formTemplate("cov", "http://www.example.org/coap-binding#"),
+		}
+	},
+	ProtocolMQTT: func() *Binding {
+		readTemplate := formTemplate("mqv:controlPacket", "subscribe")
+		// property values are published as retained messages
+		readTemplate.Set("mqv:retain", true)
+		return &Binding{
+			Base:        mqttDefaultBroker,
+			Href:        mqttDefaultTopic,
+			ContentType: "application/json",
+			Operations: map[string]*Object{
+				"readproperty":      readTemplate,
+				"writeproperty":     formTemplate("mqv:controlPacket", "publish"),
+				"observeproperty":   readTemplate,
+				"unobserveproperty": formTemplate("mqv:controlPacket", "unsubscribe"),
+				"invokeaction":      formTemplate("mqv:controlPacket", "publish"),
+				"subscribeevent":    formTemplate("mqv:controlPacket", "subscribe"),
+				"unsubscribeevent":  formTemplate("mqv:controlPacket", "unsubscribe"),
+			},
+			Context: formTemplate("mqv", "http://www.example.org/mqtt-binding#"),
+		}
+	},
+	ProtocolModbus: func() *Binding {
+		return &Binding{
+			Href:        "{{unitId|1}}/{{address}}?quantity={{quantity|1}}",
+			ContentType: "application/octet-stream",
+			Operations: map[string]*Object{
+				"readproperty":  formTemplate("modv:function", "readHoldingRegisters"),
+				"writeproperty": formTemplate("modv:function", "writeMultipleHoldingRegisters"),
+			},
+			Context: formTemplate("modv", "https://www.w3.org/2019/wot/modbus#"),
+		}
+	},
+}
+
+// affordanceOperations lists the operations of each affordance section
+var affordanceOperations = []struct {
+	section string
+	typ     string
+	ops     []string
+}{
+	{"properties", "property", []string{"readproperty", "writeproperty", "observeproperty", "unobserveproperty"}},
+	{"actions", "action", []string{"invokeaction"}},
+	{"events", "event", []string{"subscribeevent", "unsubscribeevent"}},
+}
+
+func formTemplate(keyValues ...string) *Object {
+	o := NewObject()
+	for i := 0; i+1 < len(keyValues); i += 2 {
+		o.Set(keyValues[i], keyValues[i+1])
+	}
+	return o
+}
+
+// parseBinding reads a binding template. Its members protocol, base,
+// href and contentType override the defaults of the protocol,
+// operations replace the templates of single operations, null
+// removes an operation.
+func parseBinding(data any) (*Binding, error) {
+	obj, ok := data.(*Object)
+	if !ok {
+		return nil, fmt.Errorf("binding template is not an object")
+	}
+	protocol, _ := obj.Value("protocol").(string)
+	protocol = strings.ToLower(protocol)
+	defaults, ok := bindingDefaults[protocol]
+	if !ok {
+		return nil, fmt.Errorf("unknown protocol '%s', use %s, %s, %s or %s", protocol, ProtocolHTTP, ProtocolCoAP, ProtocolMQTT, ProtocolModbus)
+	}
+	b := defaults()
+	b.Protocol = protocol
+	for key, field := range map[string]*string{"base": &b.Base, "href": &b.Href, "contentType": &b.ContentType, "registers": &b.RegisterMap} {
+		if v, found := obj.Get(key); found {
+			s, isString := v.(string)
+			if !isString {
+				return nil, fmt.Errorf("binding template: %s is not a string", key)
+			}
+			*field = s
+		}
+	}
+	ops, _ := obj.Value("operations").(*Object)
+	for _, op := range ops.Keys() {
+		switch t := ops.Value(op).(type) {
+		case nil:
+			delete(b.Operations, op)
+		case *Object:
+			b.Operations[op] = t
+		default:
+			return nil, fmt.Errorf("binding template: operation %s is not an object", op)
+		}
+	}
+	if b.RegisterMap != "" && protocol != ProtocolModbus {
+		return nil, fmt.Errorf("binding template: a register map requires protocol %s", ProtocolModbus)
+	}
+	if protocol == ProtocolMQTT {
+		if err := parseMQTT(obj, b); err != nil {
+			return nil, err
+		}
+	}
+	if ctx, ok := obj.Value("@context").(*Object); ok {
+		b.Context = overlayVars(b.Context, ctx)
+	}
+	return b, nil
+}
+
+// SetBinding loads a binding template, which generates the forms of
+// affordances without forms.
+func (p *Processor) SetBinding(filename string) error {
+	if filename == "" {
+		p.binding = nil
+		return nil
+	}
+	data, location, err := p.loadFile(filename, "")
+	if err != nil {
+		return fmt.Errorf("load binding template %s: %w", filename, err)
+	}
+	p.binding, err = parseBinding(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	if p.binding.RegisterMap != "" {
+		content, mapLocation, err := p.readFile(p.binding.RegisterMap, location)
+		if err != nil {
+			return fmt.Errorf("load register map %s: %w", p.binding.RegisterMap, err)
+		}
+		if p.binding.registers, err = parseRegisterMap(content, mapLocation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// instanceNames returns the instance names of the submodels leading
+// to p, starting at the TD
+func (p *Processor) instanceNames() []string {
+	names := make([]string, 0)
+	for q := p; q.parent != nil; q = q.parent {
+		if name := q.instance.String(); name != "" {
+			names = append([]string{name}, names...)
+		}
+		if q.submodelMode == SubmodelLink {
+			break
+		}
+	}
+	return names
+}
+
+// generateForms adds forms to the affordances of p without forms
+func (p *Processor) generateForms() error {
+	if p.binding == nil {
+		return nil
+	}
+	instances := p.instanceNames()
+	prefix := ""
+	if p.submodelMode != SubmodelLink && len(instances) > 0 {
+		prefix = strings.Join(instances, "_") + "_"
+	}
+	data := p.data.(*Object)
+	generated := false
+	var errs []error
+	for _, ao := range affordanceOperations {
+		section, _ := data.Value(ao.section).(*Object)
+		for _, name := range section.Keys() {
+			affordance, ok := section.Value(name).(*Object)
+			if !ok || len(asArray(affordance.Value("forms"))) > 0 {
+				continue
+			}
+			vars := scopedVarMap(p.VarMap, name)
+			local := formTemplate("affordance", name, "name", prefix+name, "affordanceType", ao.typ, "section", ao.section)
+			if len(instances) > 0 {
+				local.Set("instance", strings.Join(instances, "/"))
+			}
+			vars = overlayVars(vars, local)
+			var forms []any
+			var err error
+			if p.binding.registers != nil && ao.section == "properties" {
+				reg, found := p.binding.registerFor(vars)
+				if !found {
+					slog.Warn("property without register", "file", p.filename, "property", prefix+name)
+					continue
+				}
+				forms, err = p.binding.registerForms(affordance, reg, vars)
+			} else {
+				forms, err = p.binding.forms(affordance, ao.ops, vars)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: forms of %s/%s: %w", p.filename, ao.section, name, err))
+				continue
+			}
+			if len(forms) > 0 {
+				affordance.Set("forms", forms)
+				generated = true
+			}
+		}
+	}
+	if generated && p.binding.Context.Len() > 0 {
+		data.Set("@context", mergeContext(data.Value("@context"), p.binding.Context))
+	}
+	return errors.Join(errs...)
+}
+
+// forms returns a form for each operation of the affordance with a template
+func (b *Binding) forms(affordance *Object, ops []string, vars *Object) ([]any, error) {
+	readOnly, _ := affordance.Value("readOnly").(bool)
+	writeOnly, _ := affordance.Value("writeOnly").(bool)
+	observable, _ := affordance.Value("observable").(bool)
+	forms := make([]any, 0, len(ops))
+	for _, op := range ops {
+		switch op {
+		case "readproperty":
+			if writeOnly {
+				continue
+			}
+		case "writeproperty":
+			if readOnly {
+				continue
+			}
+		case "observeproperty", "unobserveproperty":
+			if !observable || writeOnly {
+				continue
+			}
+		}
+		template, ok := b.Operations[op]
+		if !ok {
+			continue
+		}
+		form := NewObject()
+		form.Set("href", b.Href)
+		if b.ContentType != "" {
+			form.Set("contentType", b.ContentType)
+		}
+		form.Set("op", op)
+		for _, key := range template.Keys() {
+			form.Set(key, deepCopy(template.Value(key)))
+		}
+		s := &substitution{vars: vars}
+		substituted, err := s.value(form, &PathObject{})
+		if err != nil {
+			return nil, err
+		}
+		if len(s.unresolved) > 0 {
+			return nil, &PlaceholderError{Unresolved: s.unresolved}
+		}
+		if href, isString := substituted.(*Object).Value("href").(string); isString && b.Protocol == ProtocolMQTT {
+			substituted.(*Object).Set("href", mqttTopic(href))
+		}
+		forms = append(forms, substituted)
+	}
+	return forms, nil
+}
+
+// setBase sets the base of the TD from the binding template
+func (p *Processor) setBase() error {
+	if p.binding == nil || p.binding.Base == "" {
+		return nil
+	}
+	s := &substitution{vars: p.VarMap}
+	base, err := s.text(p.binding.Base, (&PathObject{}).AddMap("base"))
+	if err != nil {
+		return err
+	}
+	if len(s.unresolved) > 0 {
+		return fmt.Errorf("%s: base: %w", p.filename, &PlaceholderError{Unresolved: s.unresolved})
+	}
+	if p.binding.Protocol == ProtocolMQTT {
+		base = mqttBroker(base)
+	}
+	p.data.(*Object).Set("base", base)
+	return nil
+}
@@ -0,0 +1,459 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strconv"
+	"unicode/utf8"
+)
+
+// major types of CBOR (RFC 8949)
+const (
+	cborUnsigned byte = iota
+	cborNegative
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+const (
+	cborFalse      = 0xf4
+	cborTrue       = 0xf5
+	cborNull       = 0xf6
+	cborFloat16    = 0xf9
+	cborFloat32    = 0xfa
+	cborFloat64    = 0xfb
+	cborBreak      = 0xff
+	cborIndefinite = 31
+
+	cborTagPositiveBignum = 2
+	cborTagNegativeBignum = 3
+)
+
+// cborDictionary contains the common terms of TDs. With key compression
+// a member name found in the dictionary is written as the unsigned integer
+// of its position. New terms may only be appended, so that existing
+// binary TDs can still be decoded.
+var cborDictionary = []string{
+	"@context", "@type", "id", "title", "titles", "description", "descriptions",
+	"version", "instance", "model", "created", "modified", "support", "base",
+	"properties", "actions", "events", "links", "forms", "security",
+	"securityDefinitions", "profile", "schemaDefinitions", "uriVariables",
+	"href", "contentType", "contentCoding", "subprotocol", "scopes", "response",
+	"additionalResponses", "op", "rel", "anchor", "type", "sizes", "hreflang",
+	"readOnly", "writeOnly", "observable", "unit", "enum", "const", "default",
+	"minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum", "minLength",
+	"maxLength", "multipleOf", "items", "minItems", "maxItems", "required",
+	"format", "oneOf", "contentEncoding", "contentMediaType", "input", "output",
+	"safe", "idempotent", "synchronous", "subscription", "data", "dataResponse",
+	"cancellation", "scheme", "in", "name", "instanceName",
+}
+
+// SetKeyCompression writes the member names found in the
+// dictionary of TD terms as integers in CBOR.
+func (e *Encoder) SetKeyCompression(compress bool) {
+	e.compressKeys = compress
+}
+
+// EncodeCBOR returns the CBOR serialization of data with the
+// same member order as the JSON serialization
+func (e *Encoder) EncodeCBOR(data any) ([]byte, error) {
+	e.buf.Reset()
+	if err := e.cborValue(data, tdKeyOrder); err != nil {
+		return nil, err
+	}
+	return bytes.Clone(e.buf.Bytes()), nil
+}
+
+func (e *Encoder) cborValue(data any, order []string) error {
+	switch d := data.(type) {
+	case *Object:
+		keys := d.Keys()
+		if !e.keepOrder {
+			keys = orderedKeys(d.values, order)
+		}
+		return e.cborMap(d.values, keys)
+	case map[string]any:
+		return e.cborMap(d, orderedKeys(d, order))
+	case []any:
+		e.cborHead(cborArray, uint64(len(d)))
+		for i, element := range d {
+			if err := e.cborValue(element, nil); err != nil {
+				return fmt.Errorf("%d: %w", i, err)
+			}
+		}
+	case string:
+		e.cborHead(cborText, uint64(len(d)))
+		e.buf.WriteString(d)
+	case json.Number:
+		return e.cborNumber(d)
+	case float64:
+		e.cborFloat(d)
+	case int:
+		e.cborInt(int64(d))
+	case int64:
+		e.cborInt(d)
+	case bool:
+		if d {
+			e.buf.WriteByte(cborTrue)
+		} else {
+			e.buf.WriteByte(cborFalse)
+		}
+	case nil:
+		e.buf.WriteByte(cborNull)
+	default:
+		return fmt.Errorf("cannot encode %T", d)
+	}
+	return nil
+}
+
+func (e *Encoder) cborMap(m map[string]any, keys []string) error {
+	e.cborHead(cborMap, uint64(len(keys)))
+	for _, key := range keys {
+		if idx := slices.Index(cborDictionary, key); e.compressKeys && idx >= 0 {
+			e.cborHead(cborUnsigned, uint64(idx))
+		} else {
+			e.cborHead(cborText, uint64(len(key)))
+			e.buf.WriteString(key)
+		}
+		if err := e.cborValue(m[key], nil); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// cborNumber writes integers as CBOR integers or bignums,
+// all other numbers as the shortest float without loss.
+func (e *Encoder) cborNumber(n json.Number) error {
+	if i, err := n.Int64(); err == nil {
+		e.cborInt(i)
+		return nil
+	}
+	if bi, ok := new(big.Int).SetString(n.String(), 10); ok {
+		tag, mag := uint64(cborTagPositiveBignum), bi
+		if bi.Sign() < 0 {
+			// a negative bignum encodes -1 - n
+			tag, mag = cborTagNegativeBignum, new(big.Int).Sub(new(big.Int).Neg(bi), big.NewInt(1))
+		}
+		e.cborHead(cborTag, tag)
+		b := mag.Bytes()
+		e.cborHead(cborBytes, uint64(len(b)))
+		e.buf.Write(b)
+		return nil
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return err
+	}
+	e.cborFloat(f)
+	return nil
+}
+
+func (e *Encoder) cborInt(i int64) {
+	if i < 0 {
+		e.cborHead(cborNegative, uint64(-1-i))
+	} else {
+		e.cborHead(cborUnsigned, uint64(i))
+	}
+}
+
+func (e *Encoder) cborFloat(f float64) {
+	if f32 := float32(f); float64(f32) == f || math.IsNaN(f) {
+		e.buf.WriteByte(cborFloat32)
+		e.buf.Write(binary.BigEndian.AppendUint32(nil, math.Float32bits(f32)))
+		return
+	}
+	e.buf.WriteByte(cborFloat64)
+	e.buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(f)))
+}
+
+// cborHead writes the initial byte and the argument in the shortest form
+func (e *Encoder) cborHead(major byte, arg uint64) {
+	mt := major << 5
+	switch {
+	case arg < 24:
+		e.buf.WriteByte(mt | byte(arg))
+	case arg <= math.MaxUint8:
+		e.buf.Write([]byte{mt | 24, byte(arg)})
+	case arg <= math.MaxUint16:
+		e.buf.WriteByte(mt | 25)
+		e.buf.Write(binary.BigEndian.AppendUint16(nil, uint16(arg)))
+	case arg <= math.MaxUint32:
+		e.buf.WriteByte(mt | 26)
+		e.buf.Write(binary.BigEndian.AppendUint32(nil, uint32(arg)))
+	default:
+		e.buf.WriteByte(mt | 27)
+		e.buf.Write(binary.BigEndian.AppendUint64(nil, arg))
+	}
+}
+
+// DecodeCBOR parses a CBOR document into the document model. Integer
+// member names are looked up in the dictionary of TD terms.
+func DecodeCBOR(content []byte) (any, error) {
+	d := &cborDecoder{data: content}
+	v, err := d.value()
+	if err != nil {
+		return nil, fmt.Errorf("offset %d: %w", d.pos, err)
+	}
+	if d.pos != len(content) {
+		return nil, fmt.Errorf("offset %d: unexpected data after the document", d.pos)
+	}
+	return v, nil
+}
+
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+var errCBORBreak = fmt.Errorf("unexpected break")
+
+func (d *cborDecoder) next(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.data) {
+		return nil, fmt.Errorf("unexpected end of data")
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// head reads the initial byte and its argument. The additional
+// information 31 marks indefinite lengths and the break.
+func (d *cborDecoder) head() (major byte, info byte, arg uint64, err error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info = b[0]>>5, b[0]&0x1f
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info == 24:
+		b, err = d.next(1)
+		if err == nil {
+			arg = uint64(b[0])
+		}
+	case info == 25:
+		b, err = d.next(2)
+		if err == nil {
+			arg = uint64(binary.BigEndian.Uint16(b))
+		}
+	case info == 26:
+		b, err = d.next(4)
+		if err == nil {
+			arg = uint64(binary.BigEndian.Uint32(b))
+		}
+	case info == 27:
+		b, err = d.next(8)
+		if err == nil {
+			arg = binary.BigEndian.Uint64(b)
+		}
+	case info == cborIndefinite:
+	default:
+		err = fmt.Errorf("reserved additional information %d", info)
+	}
+	return major, info, arg, err
+}
+
+func (d *cborDecoder) value() (any, error) {
+	major, info, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	indefinite := info == cborIndefinite
+	switch major {
+	case cborUnsigned:
+		return json.Number(strconv.FormatUint(arg, 10)), nil
+	case cborNegative:
+		n := new(big.Int).SetUint64(arg)
+		return json.Number(n.Neg(n).Sub(n, big.NewInt(1)).String()), nil
+	case cborBytes, cborText:
+		b, err := d.str(major, arg, indefinite)
+		if err != nil {
+			return nil, err
+		}
+		if major == cborBytes {
+			return base64.RawURLEncoding.EncodeToString(b), nil
+		}
+		if !utf8.Valid(b) {
+			return nil, fmt.Errorf("invalid utf-8 in text string")
+		}
+		return string(b), nil
+	case cborArray:
+		a := make([]any, 0)
+		for i := uint64(0); indefinite || i < arg; i++ {
+			v, err := d.value()
+			if err == errCBORBreak && indefinite {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		return a, nil
+	case cborMap:
+		o := NewObject()
+		for i := uint64(0); indefinite || i < arg; i++ {
+			k, err := d.value()
+			if err == errCBORBreak && indefinite {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			key, err := cborKey(k)
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.value()
+			if err != nil {
+				return nil, err
+			}
+			o.Set(key, v)
+		}
+		return o, nil
+	case cborTag:
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		if arg == cborTagPositiveBignum || arg == cborTagNegativeBignum {
+			return cborBignum(arg, v)
+		}
+		// other tags like the self-described CBOR tag carry no information for json
+		return v, nil
+	default:
+		return d.simple(info, arg)
+	}
+}
+
+func (d *cborDecoder) str(major byte, length uint64, indefinite bool) ([]byte, error) {
+	if !indefinite {
+		if length > uint64(len(d.data)) {
+			return nil, fmt.Errorf("string length %d exceeds the data", length)
+		}
+		return d.next(int(length))
+	}
+	var res []byte
+	for {
+		m, info, arg, err := d.head()
+		if err != nil {
+			return nil, err
+		}
+		if m == cborSimple && info == cborIndefinite {
+			return res, nil
+		}
+		if m != major || info == cborIndefinite {
+			return nil, fmt.Errorf("invalid chunk of an indefinite length string")
+		}
+		chunk, err := d.str(major, arg, false)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, chunk...)
+	}
+}
+
+func (d *cborDecoder) simple(info byte, arg uint64) (any, error) {
+	switch info {
+	case cborFalse & 0x1f:
+		return false, nil
+	case cborTrue & 0x1f:
+		return true, nil
+	case cborNull & 0x1f, cborNull&0x1f + 1:
+		// undefined is mapped to null
+		return nil, nil
+	case cborFloat16 & 0x1f:
+		return floatNumber(float16ToFloat64(uint16(arg)))
+	case cborFloat32 & 0x1f:
+		return floatNumber(float64(math.Float32frombits(uint32(arg))))
+	case cborFloat64 & 0x1f:
+		return floatNumber(math.Float64frombits(arg))
+	case cborIndefinite:
+		return nil, errCBORBreak
+	}
+	return nil, fmt.Errorf("unsupported simple value %d", arg)
+}
+
+func cborKey(k any) (string, error) {
+	switch key := k.(type) {
+	case string:
+		return key, nil
+	case json.Number:
+		idx, err := strconv.Atoi(key.String())
+		if err != nil || idx < 0 || idx >= len(cborDictionary) {
+			return "", fmt.Errorf("key %s is not in the dictionary", key)
+		}
+		return cborDictionary[idx], nil
+	}
+	return "", fmt.Errorf("unsupported key type %T", k)
+}
+
+func cborBignum(tag uint64, v any) (any, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("bignum must be a byte string")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	n := new(big.Int).SetBytes(b)
+	if tag == cborTagNegativeBignum {
+		n.Neg(n).Sub(n, big.NewInt(1))
+	}
+	return json.Number(n.String()), nil
+}
+
+func floatNumber(f float64) (any, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("%v can't be represented in json", f)
+	}
+	return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), nil
+}
+
+func float16ToFloat64(h uint16) float64 {
+	sign := 1.0
+	if h&0x8000 != 0 {
+		sign = -1
+	}
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	switch exp {
+	case 0:
+		return sign * math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			return sign * math.Inf(1)
+		}
+		return math.NaN()
+	}
+	return sign * math.Ldexp(mant+1024, exp-25)
+}
@@ -0,0 +1,151 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+)
+
+// Change is a difference between two documents
+type Change struct {
+	Kind string `json:"kind"`
+	// JSON pointer to the changed value
+	Pointer string `json:"pointer"`
+	// the value before and after the change, Old is unset for added
+	// and New for removed values
+	Old any `json:"old,omitempty"`
+	New any `json:"new,omitempty"`
+	// the change may break consumers, set by CompareTDs
+	Breaking bool   `json:"breaking"`
+	Message  string `json:"message,omitempty"`
+}
+
+// String formats a change as +, - or ~ and the pointer, modified
+// scalar values are shown with the old and the new value.
+func (c Change) String() string {
+	ptr := c.Pointer
+	if ptr == "" {
+		ptr = "/"
+	}
+	switch c.Kind {
+	case ChangeAdded:
+		return "+ " + ptr
+	case ChangeRemoved:
+		return "- " + ptr
+	}
+	if isScalar(c.Old) && isScalar(c.New) {
+		return fmt.Sprintf("~ %s: %s -> %s", ptr, shortValue(c.Old), shortValue(c.New))
+	}
+	return "~ " + ptr
+}
+
+func isScalar(v any) bool {
+	switch v.(type) {
+	case *Object, []any:
+		return false
+	}
+	return true
+}
+
+// shortValue is the JSON of a scalar, long strings are cut
+func shortValue(v any) string {
+	const maxLength = 40
+	content, _ := json.Marshal(v)
+	if len(content) > maxLength {
+		return string(content[:maxLength-3]) + "..."
+	}
+	return string(content)
+}
+
+// DiffDocuments compares two documents member by member, the members
+// of objects are compared by name and the elements of arrays by index.
+func DiffDocuments(oldDoc, newDoc any) []Change {
+	var changes []Change
+	diffValues(oldDoc, newDoc, "", &changes)
+	return changes
+}
+
+func diffValues(oldValue, newValue any, ptr string, changes *[]Change) {
+	switch o := oldValue.(type) {
+	case *Object:
+		n, ok := newValue.(*Object)
+		if !ok {
+			break
+		}
+		for _, key := range o.Keys() {
+			child := ptr + "/" + escapePointerToken(key)
+			if v, found := n.Get(key); found {
+				diffValues(o.Value(key), v, child, changes)
+			} else {
+				*changes = append(*changes, Change{Kind: ChangeRemoved, Pointer: child, Old: o.Value(key)})
+			}
+		}
+		for _, key := range n.Keys() {
+			if !o.Has(key) {
+				*changes = append(*changes, Change{Kind: ChangeAdded, Pointer: ptr + "/" + escapePointerToken(key), New: n.Value(key)})
+			}
+		}
+		return
+	case []any:
+		n, ok := newValue.([]any)
+		if !ok {
+			break
+		}
+		for i := 0; i < max(len(o), len(n)); i++ {
+			child := ptr + "/" + strconv.Itoa(i)
+			switch {
+			case i >= len(n):
+				*changes = append(*changes, Change{Kind: ChangeRemoved, Pointer: child, Old: o[i]})
+			case i >= len(o):
+				*changes = append(*changes, Change{Kind: ChangeAdded, Pointer: child, New: n[i]})
+			default:
+				diffValues(o[i], n[i], child, changes)
+			}
+		}
+		return
+	default:
+		if isScalar(newValue) && scalarEqual(oldValue, newValue) {
+			return
+		}
+	}
+	*changes = append(*changes, Change{Kind: ChangeModified, Pointer: ptr, Old: oldValue, New: newValue})
+}
+
+// scalarEqual compares numbers by their exact value, 1 and 1.0 are
+// equal, large integers like 9007199254740993 keep their precision
+func scalarEqual(a, b any) bool {
+	an, aIsNumber := a.(json.Number)
+	bn, bIsNumber := b.(json.Number)
+	if aIsNumber && bIsNumber {
+		ar, okA := new(big.Rat).SetString(string(an))
+		br, okB := new(big.Rat).SetString(string(bn))
+		if okA && okB {
+			return ar.Cmp(br) == 0
+		}
+		return an == bn
+	}
+	return a == b
+}
@@ -0,0 +1,208 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestScalarEqual(t *testing.T) {
+	tests := []struct {
+		a, b any
+		want bool
+	}{
+		{json.Number("1"), json.Number("1.0"), true},
+		{json.Number("100"), json.Number("1e2"), true},
+		{json.Number("0.1"), json.Number("0.10"), true},
+		{json.Number("9007199254740993"), json.Number("9007199254740992"), false},
+		{json.Number("12345678901234567890"), json.Number("12345678901234567891"), false},
+		{json.Number("1.5"), json.Number("1.25"), false},
+		{"a", "a", true},
+		{"1", json.Number("1"), false},
+	}
+	for _, tt := range tests {
+		if got := scalarEqual(tt.a, tt.b); got != tt.want {
+			t.Errorf("scalarEqual(%v, %v) = %t, want %t", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestDiffDocumentsLargeID(t *testing.T) {
+	old, _ := decodeJSON([]byte(`{"id": 9007199254740992}`))
+	changed, _ := decodeJSON([]byte(`{"id": 9007199254740993}`))
+	if changes := DiffDocuments(old, changed); len(changes) != 1 {
+		t.Errorf("got %v, want the changed id", changes)
+	}
+}
+
+// changeResult is the pointer of a change and if it is breaking
+type changeResult struct {
+	Pointer  string
+	Breaking bool
+}
+
+func changeResults(changes []Change) []changeResult {
+	res := make([]changeResult, 0, len(changes))
+	for _, c := range changes {
+		res = append(res, changeResult{c.Pointer, c.Breaking})
+	}
+	return res
+}
+
+func decodeObject(t *testing.T, content string) *Object {
+	t.Helper()
+	doc, err := decodeJSON([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj, ok := doc.(*Object)
+	if !ok {
+		t.Fatalf("%s is not an object", content)
+	}
+	return obj
+}
+
+func TestCompareTDs(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     []changeResult
+	}{
+		{"removed property",
+			`{"properties": {"on": {"type": "boolean"}, "dim": {"type": "integer"}}}`,
+			`{"properties": {"on": {"type": "boolean"}}}`,
+			[]changeResult{{"/properties/dim", true}}},
+		{"removed action",
+			`{"actions": {"toggle": {}}}`,
+			`{"actions": {}}`,
+			[]changeResult{{"/actions/toggle", true}}},
+		{"added event",
+			`{"events": {}}`,
+			`{"events": {"overheated": {"data": {"type": "number"}}}}`,
+			[]changeResult{{"/events/overheated", false}}},
+		{"added required input member",
+			`{"actions": {"fade": {"input": {"type": "object", "properties": {"to": {"type": "integer"}, "ms": {"type": "integer"}}, "required": ["to"]}}}}`,
+			`{"actions": {"fade": {"input": {"type": "object", "properties": {"to": {"type": "integer"}, "ms": {"type": "integer"}}, "required": ["to", "ms"]}}}}`,
+			[]changeResult{{"/actions/fade/input/required", true}}},
+		{"added required output member",
+			`{"actions": {"fade": {"output": {"type": "object", "properties": {"ms": {"type": "integer"}}}}}}`,
+			`{"actions": {"fade": {"output": {"type": "object", "properties": {"ms": {"type": "integer"}}, "required": ["ms"]}}}}`,
+			[]changeResult{{"/actions/fade/output/required", false}}},
+		{"added action input",
+			`{"actions": {"toggle": {}}}`,
+			`{"actions": {"toggle": {"input": {"type": "boolean"}}}}`,
+			[]changeResult{{"/actions/toggle/input", true}}},
+		{"read-write property narrowed",
+			`{"properties": {"dim": {"type": "integer", "minimum": 0}}}`,
+			`{"properties": {"dim": {"type": "integer", "minimum": 10}}}`,
+			[]changeResult{{"/properties/dim/minimum", true}}},
+		{"read-write property widened",
+			`{"properties": {"dim": {"type": "integer", "enum": [1, 2]}}}`,
+			`{"properties": {"dim": {"type": "integer", "enum": [1, 2, 3]}}}`,
+			[]changeResult{{"/properties/dim/enum", true}}},
+		{"read-only property narrowed",
+			`{"properties": {"dim": {"type": "integer", "readOnly": true, "minimum": 0}}}`,
+			`{"properties": {"dim": {"type": "integer", "readOnly": true, "minimum": 10}}}`,
+			[]changeResult{{"/properties/dim/minimum", false}}},
+		{"property made read-only",
+			`{"properties": {"dim": {"type": "integer"}}}`,
+			`{"properties": {"dim": {"type": "integer", "readOnly": true}}}`,
+			[]changeResult{{"/properties/dim/readOnly", true}}},
+		{"changed form href",
+			`{"properties": {"on": {"type": "boolean", "forms": [{"href": "on"}]}}}`,
+			`{"properties": {"on": {"type": "boolean", "forms": [{"href": "power"}]}}}`,
+			[]changeResult{{"/properties/on/forms/0/href", true}}},
+		{"added form",
+			`{"properties": {"on": {"type": "boolean", "forms": [{"href": "on"}]}}}`,
+			`{"properties": {"on": {"type": "boolean", "forms": [{"href": "on"}, {"href": "on/obs", "op": ["observeproperty"]}]}}}`,
+			[]changeResult{{"/properties/on/forms/1", false}}},
+		{"changed title and base",
+			`{"title": "Lamp", "base": "http://lamp-kitchen/"}`,
+			`{"title": "Kitchen lamp", "base": "http://lamp/"}`,
+			[]changeResult{{"/title", false}, {"/base", true}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := changeResults(CompareTDs(decodeObject(t, tt.old), decodeObject(t, tt.new)))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareSchema(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		dir      dataDirection
+		want     []changeResult
+	}{
+		{"narrowed minimum of input", `{"minimum": 0}`, `{"minimum": 5}`, dirInput, []changeResult{{"/minimum", true}}},
+		{"widened minimum of input", `{"minimum": 5}`, `{"minimum": 0}`, dirInput, []changeResult{{"/minimum", false}}},
+		{"narrowed minimum of output", `{"minimum": 0}`, `{"minimum": 5}`, dirOutput, []changeResult{{"/minimum", false}}},
+		{"widened minimum of output", `{"minimum": 5}`, `{"minimum": 0}`, dirOutput, []changeResult{{"/minimum", true}}},
+		{"added minimum of output", `{}`, `{"minimum": 0}`, dirOutput, []changeResult{{"/minimum", false}}},
+		{"removed minimum of output", `{"minimum": 0}`, `{}`, dirOutput, []changeResult{{"/minimum", true}}},
+		{"widened minimum of both", `{"minimum": 5}`, `{"minimum": 0}`, dirBoth, []changeResult{{"/minimum", true}}},
+		{"narrowed enum of input", `{"enum": ["a", "b"]}`, `{"enum": ["a"]}`, dirInput, []changeResult{{"/enum", true}}},
+		{"widened enum of input", `{"enum": ["a"]}`, `{"enum": ["a", "b"]}`, dirInput, []changeResult{{"/enum", false}}},
+		{"narrowed enum of output", `{"enum": ["a", "b"]}`, `{"enum": ["a"]}`, dirOutput, []changeResult{{"/enum", false}}},
+		{"widened enum of output", `{"enum": ["a"]}`, `{"enum": ["a", "b"]}`, dirOutput, []changeResult{{"/enum", true}}},
+		{"integer to number of input", `{"type": "integer"}`, `{"type": "number"}`, dirInput, []changeResult{{"/type", false}}},
+		{"integer to number of output", `{"type": "integer"}`, `{"type": "number"}`, dirOutput, []changeResult{{"/type", true}}},
+		{"changed description", `{"description": "a"}`, `{"description": "b"}`, dirBoth, []changeResult{{"/description", false}}},
+		{"same number", `{"maximum": 1}`, `{"maximum": 1.0}`, dirBoth, []changeResult{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &tdComparison{}
+			c.compareSchema(decodeObject(t, tt.old), decodeObject(t, tt.new), "", tt.dir, nil)
+			if got := changeResults(c.changes); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareForms(t *testing.T) {
+	defaults := []string{"readproperty", "writeproperty"}
+	tests := []struct {
+		name     string
+		old, new string
+		want     []changeResult
+	}{
+		{"changed href", `[{"href": "a"}]`, `[{"href": "b"}]`, []changeResult{{"/forms/0/href", true}}},
+		{"added form", `[{"href": "a"}]`, `[{"href": "a"}, {"href": "a", "op": "observeproperty"}]`, []changeResult{{"/forms/1", false}}},
+		{"removed operation", `[{"href": "a"}]`, `[{"href": "a", "op": "readproperty"}]`, []changeResult{{"/forms/0", true}}},
+		{"split operations", `[{"href": "a"}]`, `[{"href": "a", "op": "readproperty"}, {"href": "a", "op": ["writeproperty"]}]`, []changeResult{}},
+		{"changed content type", `[{"href": "a"}]`, `[{"href": "a", "contentType": "text/plain"}]`, []changeResult{{"/forms/0/contentType", true}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldForms, _ := decodeJSON([]byte(tt.old))
+			newForms, _ := decodeJSON([]byte(tt.new))
+			c := &tdComparison{}
+			c.compareForms(oldForms, newForms, defaults, "")
+			if got := changeResults(c.changes); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
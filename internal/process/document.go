@@ -0,0 +1,207 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// Object is a JSON object, which keeps the order of its members.
+// Documents are decoded into *Object, []any, string, json.Number,
+// bool and nil, so the key order and the precision of numbers
+// are kept from loading to output.
+type Object struct {
+	keys   []string
+	values map[string]any
+}
+
+func NewObject() *Object {
+	return &Object{keys: make([]string, 0), values: make(map[string]any)}
+}
+
+// Get returns the value of the member key, a nil object has no members
+func (o *Object) Get(key string) (any, bool) {
+	if o == nil {
+		return nil, false
+	}
+	v, ok := o.values[key]
+	return v, ok
+}
+
+// Value returns the value of the member key or nil
+func (o *Object) Value(key string) any {
+	v, _ := o.Get(key)
+	return v
+}
+
+// Has reports if the object contains the member key
+func (o *Object) Has(key string) bool {
+	_, ok := o.Get(key)
+	return ok
+}
+
+// Set replaces the value of the member key, new members are appended
+func (o *Object) Set(key string, v any) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = v
+}
+
+// Delete removes the member key
+func (o *Object) Delete(key string) {
+	if _, ok := o.values[key]; !ok {
+		return
+	}
+	delete(o.values, key)
+	o.keys = slices.DeleteFunc(o.keys, func(k string) bool { return k == key })
+}
+
+// Keys returns the member names in their order. The result may be
+// kept while the object is modified.
+func (o *Object) Keys() []string {
+	if o == nil {
+		return []string{}
+	}
+	return slices.Clone(o.keys)
+}
+
+func (o *Object) Len() int {
+	if o == nil {
+		return 0
+	}
+	return len(o.keys)
+}
+
+// Clone returns a shallow copy of the object
+func (o *Object) Clone() *Object {
+	c := NewObject()
+	for _, key := range o.Keys() {
+		c.Set(key, o.values[key])
+	}
+	return c
+}
+
+// MarshalJSON writes the members in their order
+func (o *Object) MarshalJSON() ([]byte, error) {
+	enc := NewEncoder("")
+	enc.SetKeepOrder(true)
+	return enc.Encode(o)
+}
+
+// decodeJSON parses content into the ordered document model
+func decodeJSON(content []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.UseNumber()
+	v, err := decodeValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid character after top-level value at offset %d", dec.InputOffset())
+	}
+	return v, nil
+}
+
+func decodeValue(dec *json.Decoder) (any, error) {
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t {
+	case json.Delim('{'):
+		o := NewObject()
+		for dec.More() {
+			kt, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key := kt.(string)
+			v, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			o.Set(key, v)
+		}
+		_, err = dec.Token()
+		return o, err
+	case json.Delim('['):
+		a := make([]any, 0)
+		for dec.More() {
+			v, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		_, err = dec.Token()
+		return a, err
+	default:
+		return t, nil
+	}
+}
+
+// plainValue converts objects to maps, e.g. for the schema validation
+func plainValue(v any) any {
+	switch d := v.(type) {
+	case *Object:
+		m := make(map[string]any, d.Len())
+		for _, key := range d.keys {
+			m[key] = plainValue(d.values[key])
+		}
+		return m
+	case map[string]any:
+		m := make(map[string]any, len(d))
+		for key, element := range d {
+			m[key] = plainValue(element)
+		}
+		return m
+	case []any:
+		a := make([]any, len(d))
+		for i, element := range d {
+			a[i] = plainValue(element)
+		}
+		return a
+	default:
+		return v
+	}
+}
+
+// orderedValue converts maps to objects with members sorted by name,
+// e.g. for values of the placeholder map inserted into a document
+func orderedValue(v any) any {
+	switch d := v.(type) {
+	case map[string]any:
+		o := NewObject()
+		for _, key := range sortedKeys(d) {
+			o.Set(key, orderedValue(d[key]))
+		}
+		return o
+	case []any:
+		a := make([]any, len(d))
+		for i, element := range d {
+			a[i] = orderedValue(element)
+		}
+		return a
+	default:
+		return v
+	}
+}
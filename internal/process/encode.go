@@ -0,0 +1,178 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// DefaultIndent is the indentation of the written TDs
+const DefaultIndent = "\t"
+
+// formats of the written TDs
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatCBOR = "cbor"
+	// RDF formats of the expanded TD
+	FormatNTriples = "ntriples"
+	FormatTurtle   = "turtle"
+)
+
+// tdKeyOrder is the order of the top level members of a TD,
+// all other members follow sorted by name.
+var tdKeyOrder = []string{"@context", "title", "@type", "id", "description", "version", "base", "securityDefinitions", "security", "links", "properties", "actions", "events"}
+
+// Encoder serializes documents to JSON. The top level members are
+// written in the order of a TD, the members of nested objects sorted by name.
+// With keepOrder the members are written in the order of the document.
+// An empty indent writes compact JSON.
+type Encoder struct {
+	indent       string
+	keepOrder    bool
+	compressKeys bool
+	buf          bytes.Buffer
+}
+
+func NewEncoder(indent string) *Encoder {
+	return &Encoder{indent: indent}
+}
+
+// SetKeepOrder writes the members of objects in the order of the document
+func (e *Encoder) SetKeepOrder(keepOrder bool) {
+	e.keepOrder = keepOrder
+}
+
+// Encode returns the JSON serialization of data
+func (e *Encoder) Encode(data any) ([]byte, error) {
+	e.buf.Reset()
+	if err := e.value(data, 0, tdKeyOrder); err != nil {
+		return nil, err
+	}
+	if e.indent != "" {
+		e.buf.WriteByte('\n')
+	}
+	return bytes.Clone(e.buf.Bytes()), nil
+}
+
+func (e *Encoder) value(data any, depth int, order []string) error {
+	switch d := data.(type) {
+	case *Object:
+		keys := d.Keys()
+		if !e.keepOrder {
+			keys = orderedKeys(d.values, order)
+		}
+		return e.object(d.values, keys, depth)
+	case map[string]any:
+		return e.object(d, orderedKeys(d, order), depth)
+	case []any:
+		return e.array(d, depth)
+	case nil, string, bool, json.Number, float32, float64, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return e.literal(d)
+	default:
+		return fmt.Errorf("cannot encode %T", d)
+	}
+}
+
+func (e *Encoder) object(m map[string]any, keys []string, depth int) error {
+	if len(keys) == 0 {
+		e.buf.WriteString("{}")
+		return nil
+	}
+	e.buf.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			e.buf.WriteByte(',')
+		}
+		e.newline(depth + 1)
+		if err := e.literal(key); err != nil {
+			return err
+		}
+		e.buf.WriteByte(':')
+		if e.indent != "" {
+			e.buf.WriteByte(' ')
+		}
+		if err := e.value(m[key], depth+1, nil); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	e.newline(depth)
+	e.buf.WriteByte('}')
+	return nil
+}
+
+func (e *Encoder) array(a []any, depth int) error {
+	if len(a) == 0 {
+		e.buf.WriteString("[]")
+		return nil
+	}
+	e.buf.WriteByte('[')
+	for i, element := range a {
+		if i > 0 {
+			e.buf.WriteByte(',')
+		}
+		e.newline(depth + 1)
+		if err := e.value(element, depth+1, nil); err != nil {
+			return fmt.Errorf("%d: %w", i, err)
+		}
+	}
+	e.newline(depth)
+	e.buf.WriteByte(']')
+	return nil
+}
+
+// literal writes a string, number, boolean or null. HTML characters
+// are not escaped, so hrefs and descriptions stay readable.
+func (e *Encoder) literal(v any) error {
+	var lit bytes.Buffer
+	enc := json.NewEncoder(&lit)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	e.buf.Write(bytes.TrimSuffix(lit.Bytes(), []byte("\n")))
+	return nil
+}
+
+func (e *Encoder) newline(depth int) {
+	if e.indent == "" {
+		return
+	}
+	e.buf.WriteByte('\n')
+	e.buf.WriteString(strings.Repeat(e.indent, depth))
+}
+
+// orderedKeys returns the keys in the given order followed by
+// the remaining keys sorted by name
+func orderedKeys(m map[string]any, order []string) []string {
+	keys := make([]string, 0, len(m))
+	for _, key := range order {
+		if _, ok := m[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range sortedKeys(m) {
+		if !slices.Contains(order, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,133 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// modelFiles returns all json files of the example models
+func modelFiles(t *testing.T) []string {
+	t.Helper()
+	var files []string
+	err := filepath.WalkDir("../../model", func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && (strings.HasSuffix(path, ".json") || strings.HasSuffix(path, ".jsonld")) {
+			files = append(files, path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no model files found")
+	}
+	return files
+}
+
+// roundTrip encodes data and decodes the result again
+func roundTrip(t *testing.T, data any, indent string, keepOrder bool) ([]byte, any) {
+	t.Helper()
+	enc := NewEncoder(indent)
+	enc.SetKeepOrder(keepOrder)
+	content, err := enc.Encode(data)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if !json.Valid(content) {
+		t.Fatalf("encoded document is not valid json:\n%s", content)
+	}
+	decoded, err := decodeJSON(content)
+	if err != nil {
+		t.Fatalf("decode the encoded document: %v", err)
+	}
+	return content, decoded
+}
+
+// keyOrder lists the member names of all objects depth first
+func keyOrder(data any) []string {
+	var keys []string
+	switch d := data.(type) {
+	case *Object:
+		for _, key := range d.Keys() {
+			keys = append(keys, key)
+			keys = append(keys, keyOrder(d.Value(key))...)
+		}
+	case []any:
+		for _, v := range d {
+			keys = append(keys, keyOrder(v)...)
+		}
+	}
+	return keys
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	for _, file := range modelFiles(t) {
+		t.Run(filepath.ToSlash(file), func(t *testing.T) {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := decodeJSON(content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, indent := range []string{DefaultIndent, ""} {
+				encoded, decoded := roundTrip(t, data, indent, false)
+				if changes := DiffDocuments(data, decoded); len(changes) > 0 {
+					t.Errorf("indent %q: the decoded document differs: %v", indent, changes)
+				}
+				again, _ := roundTrip(t, decoded, indent, false)
+				if !bytes.Equal(encoded, again) {
+					t.Errorf("indent %q: encoding is not stable:\n%s\n%s", indent, encoded, again)
+				}
+			}
+			_, decoded := roundTrip(t, data, DefaultIndent, true)
+			if !slices.Equal(keyOrder(data), keyOrder(decoded)) {
+				t.Errorf("keep order changed the order of the members:\n%v\n%v", keyOrder(data), keyOrder(decoded))
+			}
+		})
+	}
+}
+
+func TestEncodeSpecialKeys(t *testing.T) {
+	content := []byte(`{"properties":{"say \"hi\"":{"title":"Grüße <&>","ä\\ö":1,"日本":"é"}},` +
+		`"title":"Température","@context":"https://www.w3.org/2022/wot/td/v1.1","z":9007199254740993}`)
+	data, err := decodeJSON(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, decoded := roundTrip(t, data, DefaultIndent, false)
+	if changes := DiffDocuments(data, decoded); len(changes) > 0 {
+		t.Errorf("the decoded document differs: %v", changes)
+	}
+	want := []string{"@context", "title", "properties", "say \"hi\"", "title", "ä\\ö", "日本", "z"}
+	if got := keyOrder(decoded); !slices.Equal(got, want) {
+		t.Errorf("got the members %v, want %v", got, want)
+	}
+	for _, s := range []string{`"Grüße <&>"`, `"say \"hi\""`, `9007199254740993`} {
+		if !bytes.Contains(encoded, []byte(s)) {
+			t.Errorf("%s is not written unchanged:\n%s", s, encoded)
+		}
+	}
+}
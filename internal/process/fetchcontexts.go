@@ -0,0 +1,74 @@
+//go:build ignore
+
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// fetchcontexts downloads the published JSON-LD contexts listed in
+// context/sources.json, the files are stored unchanged.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func main() {
+	content, err := os.ReadFile("context/sources.json")
+	if err != nil {
+		log.Fatal(err)
+	}
+	sources := make(map[string]string)
+	if err = json.Unmarshal(content, &sources); err != nil {
+		log.Fatal(err)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	for url, file := range sources {
+		if err = fetch(client, url, filepath.Join("context", file)); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%s -> %s\n", url, file)
+	}
+}
+
+func fetch(client *http.Client, url string, file string) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/ld+json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to fetch %s: %s", url, resp.Status)
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if !json.Valid(content) {
+		return fmt.Errorf("%s is not a JSON-LD document", url)
+	}
+	return os.WriteFile(file, content, 0644)
+}
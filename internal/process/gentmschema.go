@@ -0,0 +1,167 @@
+//go:build ignore
+
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// gentmschema generates the TM schema from the TD schema. A thing model
+// may omit every member except @context and @type, which contains
+// tm:ThingModel, forms may be empty and every value may be a
+// placeholder, the other constraints of the TD schema are kept.
+package main
+
+import (
+	"log"
+	"os"
+	"slices"
+
+	"github.com/wot-oss/tmtd/internal/process"
+)
+
+const (
+	tdSchemaFile = "schema/td-json-schema-validation.json"
+	tmSchemaFile = "schema/tm-json-schema-validation.json"
+	placeholder  = "#/definitions/placeholder"
+)
+
+// schemaKeys are the members containing a schema, schemaMapKeys and
+// schemaListKeys contain maps and lists of schemas. The schema of not
+// is kept, allowing a placeholder there would reject it.
+var (
+	schemaKeys     = []string{"additionalProperties", "additionalItems", "contains"}
+	schemaMapKeys  = []string{"definitions", "properties"}
+	schemaListKeys = []string{"oneOf", "anyOf", "allOf", "items"}
+)
+
+func main() {
+	content, err := os.ReadFile(tdSchemaFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	doc, err := process.ParseDocument(content, tdSchemaFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	td := doc.(*process.Object)
+	tm := process.NewObject()
+	tm.Set("title", "Thing Model")
+	tm.Set("version", td.Value("version"))
+	tm.Set("description", "JSON Schema for validating Thing Models, generated from the TD JSON Schema by gentmschema.go")
+	tm.Set("$schema", td.Value("$schema"))
+	for _, key := range td.Keys() {
+		if !tm.Has(key) && key != "$id" {
+			tm.Set(key, convert(td.Value(key), key))
+		}
+	}
+	definitions := tm.Value("definitions").(*process.Object)
+	definitions.Set("placeholder", object("type", "string", "pattern", `\{\{[^{}]+\}\}`))
+	definitions.Set("tm_type_declaration", object("oneOf", []any{
+		object("const", "tm:ThingModel"),
+		object("type", "array", "contains", object("const", "tm:ThingModel")),
+	}))
+	definitions.Set("tm_pointer_list", object("type", "array", "items", object("type", "string", "pattern", "^#/")))
+	properties := tm.Value("properties").(*process.Object)
+	properties.Set("@type", object("$ref", "#/definitions/tm_type_declaration"))
+	properties.Set("tm:required", object("$ref", "#/definitions/tm_pointer_list"))
+	properties.Set("tm:optional", object("$ref", "#/definitions/tm_pointer_list"))
+	tm.Set("required", []any{"@context", "@type"})
+
+	enc := process.NewEncoder("    ")
+	enc.SetKeepOrder(true)
+	out, err := enc.Encode(tm)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = os.WriteFile(tmSchemaFile, append(out, '\n'), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func object(members ...any) *process.Object {
+	o := process.NewObject()
+	for i := 0; i < len(members); i += 2 {
+		o.Set(members[i].(string), members[i+1])
+	}
+	return o
+}
+
+// convert applies the rules of thing models to a member of a schema
+func convert(v any, key string) any {
+	switch {
+	case slices.Contains(schemaMapKeys, key):
+		m, ok := v.(*process.Object)
+		if !ok {
+			return v
+		}
+		res := process.NewObject()
+		for _, name := range m.Keys() {
+			s := m.Value(name)
+			if forms, ok := s.(*process.Object); ok && key == "properties" && name == "forms" {
+				// thing models may leave the forms to the binding
+				s = forms.Clone()
+				s.(*process.Object).Delete("minItems")
+			}
+			res.Set(name, convertSchema(s))
+		}
+		return res
+	case slices.Contains(schemaListKeys, key):
+		if l, ok := v.([]any); ok {
+			res := make([]any, len(l))
+			for i, s := range l {
+				res[i] = convertSchema(s)
+			}
+			return res
+		}
+		return convertSchema(v)
+	case slices.Contains(schemaKeys, key):
+		return convertSchema(v)
+	}
+	return v
+}
+
+// convertSchema drops the required members of a schema and allows a
+// placeholder instead of values, which are no strings or restricted
+// strings
+func convertSchema(v any) any {
+	s, ok := v.(*process.Object)
+	if !ok {
+		return v
+	}
+	res := process.NewObject()
+	for _, key := range s.Keys() {
+		if key != "required" {
+			res.Set(key, convert(s.Value(key), key))
+		}
+	}
+	if !rejectsPlaceholder(res) {
+		return res
+	}
+	return object("anyOf", []any{res, object("$ref", placeholder)})
+}
+
+func rejectsPlaceholder(s *process.Object) bool {
+	for _, key := range []string{"enum", "const", "pattern", "format", "oneOf"} {
+		if s.Has(key) {
+			return true
+		}
+	}
+	switch t := s.Value("type").(type) {
+	case string:
+		return t != "string"
+	case []any:
+		return !slices.Contains(t, any("string"))
+	}
+	return false
+}
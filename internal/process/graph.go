@@ -0,0 +1,243 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	GraphFormatDOT     = "dot"
+	GraphFormatMermaid = "mermaid"
+	GraphFormatJSON    = "json"
+
+	EdgeExtends  = "extends"
+	EdgeSubmodel = "submodel"
+	EdgeRef      = "ref"
+)
+
+// GraphNode is a model of the dependency graph
+type GraphNode struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Title    string `json:"title,omitempty"`
+	Location string `json:"location"`
+	// the model could not be loaded
+	Missing bool `json:"missing,omitempty"`
+	// the model has no edges
+	Orphan bool `json:"orphan,omitempty"`
+}
+
+// GraphEdge is a dependency between two models, the label is the
+// instance name of a submodel or the JSON pointer of a tm:ref
+type GraphEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Kind  string `json:"kind"`
+	Label string `json:"label,omitempty"`
+}
+
+// ModelGraph is the graph of the tm:extends, tm:submodel and tm:ref
+// dependencies of models
+type ModelGraph struct {
+	Nodes []*GraphNode `json:"nodes"`
+	Edges []GraphEdge  `json:"edges"`
+	// node by location
+	index map[string]*GraphNode
+}
+
+func newModelGraph() *ModelGraph {
+	return &ModelGraph{Nodes: make([]*GraphNode, 0), Edges: make([]GraphEdge, 0), index: make(map[string]*GraphNode)}
+}
+
+// node returns the node of location, a new node is missing until the
+// model is loaded
+func (g *ModelGraph) node(location string) *GraphNode {
+	if n, found := g.index[location]; found {
+		return n
+	}
+	n := &GraphNode{ID: "n" + strconv.Itoa(len(g.Nodes)), Name: ModelName(location), Location: location, Missing: true}
+	g.Nodes = append(g.Nodes, n)
+	g.index[location] = n
+	return n
+}
+
+// addModel records a loaded model
+func (g *ModelGraph) addModel(location string, data any) {
+	n := g.node(location)
+	n.Missing = false
+	if obj, ok := data.(*Object); ok {
+		n.Title, _ = obj.Value("title").(string)
+	}
+}
+
+func (g *ModelGraph) addEdge(from string, to string, kind string, label string) {
+	e := GraphEdge{From: g.node(from).ID, To: g.node(to).ID, Kind: kind, Label: label}
+	if !slices.Contains(g.Edges, e) {
+		g.Edges = append(g.Edges, e)
+	}
+}
+
+// recordLink adds the edge of a tm:extends or tm:submodel link processed
+// by target. If the model was not loaded, the edge ends at href.
+func (p *Processor) recordLink(kind string, href string, target *Processor, label string) {
+	if p.graph == nil {
+		return
+	}
+	to := target.location
+	if to == "" {
+		to = href
+	}
+	p.graph.addEdge(p.location, to, kind, label)
+}
+
+// recordReference adds the edge of a tm:ref to another file. If the
+// file was not loaded, the edge ends at href.
+func (p *Processor) recordReference(from string, href string, location string, data any, ptr string) {
+	if p.graph == nil {
+		return
+	}
+	if location == "" {
+		location = href
+	} else {
+		p.graph.addModel(location, data)
+	}
+	p.graph.addEdge(from, location, EdgeRef, ptr)
+}
+
+// Graph processes the models and returns the graph of their
+// dependencies. Models, which can't be built, are part of the graph
+// as far as their dependencies are resolved.
+func (p *Processor) Graph(models []string) *ModelGraph {
+	g := newModelGraph()
+	for _, model := range models {
+		gp := p.newBatchProcessor()
+		gp.graph = g
+		if err := gp.Process(model); err != nil {
+			slog.Warn("model not completely processed", "model", model, "error", err)
+		}
+		if gp.location == "" {
+			g.node(model)
+		}
+	}
+	linked := make(map[string]bool)
+	for _, e := range g.Edges {
+		linked[e.From], linked[e.To] = true, true
+	}
+	for _, n := range g.Nodes {
+		n.Orphan = !linked[n.ID]
+	}
+	return g
+}
+
+// CatalogueModels returns the absolute paths of all models in the search path
+func CatalogueModels(searchPath string) []string {
+	var models []string
+	for _, m := range ListModels(searchPath) {
+		path, err := filepath.Abs(m.Path)
+		if err != nil {
+			path = m.Path
+		}
+		models = append(models, path)
+	}
+	return models
+}
+
+// WriteGraph writes the graph in the given format
+func WriteGraph(w io.Writer, format string, g *ModelGraph) error {
+	switch format {
+	case GraphFormatDOT, "":
+		return writeGraphDOT(w, g)
+	case GraphFormatMermaid:
+		return writeGraphMermaid(w, g)
+	case GraphFormatJSON:
+		return writeJSON(w, g)
+	default:
+		return fmt.Errorf("unknown graph format '%s', expected one of %s, %s, %s", format, GraphFormatDOT, GraphFormatMermaid, GraphFormatJSON)
+	}
+}
+
+// writeGraphDOT writes a Graphviz digraph, extends edges have the
+// hollow arrow of an inheritance, submodel edges a diamond and
+// references are dashed
+func writeGraphDOT(w io.Writer, g *ModelGraph) error {
+	var b strings.Builder
+	b.WriteString("digraph models {\n\trankdir=LR;\n\tnode [shape=box];\n")
+	for _, n := range g.Nodes {
+		attrs := []string{"label=" + strconv.Quote(n.Name)}
+		if n.Title != "" {
+			attrs = append(attrs, "tooltip="+strconv.Quote(n.Title))
+		}
+		if n.Missing {
+			attrs = append(attrs, "style=dashed", "color=red")
+		}
+		fmt.Fprintf(&b, "\t%s [%s];\n", n.ID, strings.Join(attrs, ", "))
+	}
+	for _, e := range g.Edges {
+		var attrs []string
+		if e.Label != "" {
+			attrs = append(attrs, "label="+strconv.Quote(e.Label))
+		}
+		switch e.Kind {
+		case EdgeExtends:
+			attrs = append(attrs, "arrowhead=empty")
+		case EdgeSubmodel:
+			attrs = append(attrs, "arrowtail=diamond", "dir=both")
+		case EdgeRef:
+			attrs = append(attrs, "style=dashed")
+		}
+		fmt.Fprintf(&b, "\t%s -> %s [%s];\n", e.From, e.To, strings.Join(attrs, ", "))
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeGraphMermaid writes a Mermaid flowchart, extends edges are
+// thick and references dotted
+func writeGraphMermaid(w io.Writer, g *ModelGraph) error {
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for _, n := range g.Nodes {
+		if n.Missing {
+			fmt.Fprintf(&b, "    %s[/%s/]\n", n.ID, mermaidText(n.Name+" (missing)"))
+		} else {
+			fmt.Fprintf(&b, "    %s[%s]\n", n.ID, mermaidText(n.Name))
+		}
+	}
+	for _, e := range g.Edges {
+		arrow := map[string]string{EdgeExtends: "==>", EdgeSubmodel: "-->", EdgeRef: "-.->"}[e.Kind]
+		label := ""
+		if e.Label != "" {
+			label = "|" + mermaidText(e.Label) + "|"
+		}
+		fmt.Fprintf(&b, "    %s %s%s %s\n", e.From, arrow, label, e.To)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// mermaidText quotes a text, quotes in the text are written as entity
+func mermaidText(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+}
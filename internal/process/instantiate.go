@@ -0,0 +1,218 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A device list has the placeholder values of one device per row. In
+// a CSV file the header row names the placeholders, a name like
+// location.room creates nested values. The values of a CSV file are
+// strings, typed placeholders like {{port:integer}} convert them, empty
+// cells are unset.
+// A JSONL file has a JSON object per line and keeps the JSON types.
+
+// DeviceIndexFile is the name of the index of the TDs written by instantiate
+const DeviceIndexFile = "index.json"
+
+// LoadDevices reads a CSV or JSONL device list, the format follows
+// the extension .csv, .jsonl or .ndjson
+func LoadDevices(filename string) ([]*Object, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return parseDevicesCSV(content, filename)
+	case ".jsonl", ".ndjson":
+		return parseDevicesJSONL(content, filename)
+	}
+	return nil, fmt.Errorf("unknown device list format of %s, use .csv or .jsonl", filename)
+}
+
+func parseDevicesCSV(content []byte, filename string) ([]*Object, error) {
+	r := csv.NewReader(bytes.NewReader(content))
+	r.Comment = '#'
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+		if header[i] == "" {
+			return nil, fmt.Errorf("%s: column %d has no name", filename, i+1)
+		}
+	}
+	var devices []*Object
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return devices, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+		device := NewObject()
+		for i, value := range record {
+			// empty cells are unset, so the defaults of placeholders apply
+			if value != "" {
+				setNested(device, strings.Split(header[i], "."), value)
+			}
+		}
+		devices = append(devices, device)
+	}
+}
+
+// setNested sets the value of a dotted name, e.g. location.room
+func setNested(obj *Object, names []string, value any) {
+	for _, name := range names[:len(names)-1] {
+		nested, ok := obj.Value(name).(*Object)
+		if !ok {
+			nested = NewObject()
+			obj.Set(name, nested)
+		}
+		obj = nested
+	}
+	obj.Set(names[len(names)-1], value)
+}
+
+func parseDevicesJSONL(content []byte, filename string) ([]*Object, error) {
+	var devices []*Object
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, maxRemoteSize)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		data, err := decodeJSON([]byte(text))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", filename, line, err)
+		}
+		device, ok := data.(*Object)
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: the line is not a json object", filename, line)
+		}
+		devices = append(devices, device)
+	}
+	return devices, scanner.Err()
+}
+
+// DeviceManifest creates a manifest, which builds model once per device
+// with the values of the device. nameTemplate names the TDs, e.g.
+// {{id}}.td.jsonld
+func DeviceManifest(model string, devices []*Object, nameTemplate string) (*Manifest, error) {
+	m := &Manifest{}
+	var errs []error
+	for i, device := range devices {
+		name, err := expandName(nameTemplate, device)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("device %d: %w", i+1, err))
+			continue
+		}
+		m.Entries = append(m.Entries, ManifestEntry{Model: model, Vars: device, Output: name})
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// expandName replaces the placeholders of a file name template
+func expandName(nameTemplate string, vars *Object) (string, error) {
+	s := &substitution{vars: vars}
+	name, err := s.text(nameTemplate, &PathObject{})
+	if err != nil {
+		return "", err
+	}
+	if len(s.unresolved) > 0 {
+		placeholders := make([]string, len(s.unresolved))
+		for i, u := range s.unresolved {
+			placeholders[i] = u.Placeholder
+		}
+		return "", fmt.Errorf("unresolved placeholders %s in file name %s", strings.Join(placeholders, ", "), nameTemplate)
+	}
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return "", fmt.Errorf("invalid file name '%s'", name)
+	}
+	return name, nil
+}
+
+// WriteTDArray writes the TDs of the successful results as a JSON array
+func WriteTDArray(w io.Writer, results []BatchResult, indent string) error {
+	tds := make([]json.RawMessage, 0, len(results))
+	for _, r := range results {
+		if r.Err == nil {
+			tds = append(tds, r.Content)
+		}
+	}
+	content, err := json.Marshal(tds)
+	if err != nil {
+		return err
+	}
+	if indent != "" {
+		var b bytes.Buffer
+		if err := json.Indent(&b, content, "", indent); err != nil {
+			return err
+		}
+		content = b.Bytes()
+	}
+	_, err = w.Write(append(content, '\n'))
+	return err
+}
+
+// deviceIndexEntry describes a written TD in the index
+type deviceIndexEntry struct {
+	File  string `json:"file"`
+	ID    string `json:"id,omitempty"`
+	Title string `json:"title,omitempty"`
+}
+
+// WriteDeviceIndex writes the file names, ids and titles of the TDs of
+// the successful results to index.json in dir
+func WriteDeviceIndex(dir string, results []BatchResult) error {
+	index := make([]deviceIndexEntry, 0, len(results))
+	for _, r := range results {
+		if r.Err != nil {
+			continue
+		}
+		e := deviceIndexEntry{File: r.Output}
+		e.ID, _ = r.TD.Value("id").(string)
+		e.Title, _ = r.TD.Value("title").(string)
+		index = append(index, e)
+	}
+	content, err := json.MarshalIndent(index, "", DefaultIndent)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, DeviceIndexFile), append(content, '\n'), 0644)
+}
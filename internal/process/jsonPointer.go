@@ -0,0 +1,138 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// parsePointer splits a JSON pointer (RFC 6901) into its unescaped
+// reference tokens. The empty pointer references the whole document.
+func parsePointer(ptr string) ([]string, error) {
+	if ptr == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(ptr, "/") {
+		return nil, fmt.Errorf("json pointer '%s' must start with '/'", ptr)
+	}
+	tokens := strings.Split(ptr[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = unescapePointerToken(t)
+	}
+	return tokens, nil
+}
+
+// fragmentToPointer converts the fragment of an URI reference like
+// "#/properties/dim" to a JSON pointer. Percent encoded characters
+// are decoded. For compatibility a missing leading '/' is added.
+func fragmentToPointer(fragment string) (string, error) {
+	ptr, err := url.PathUnescape(fragment)
+	if err != nil {
+		return "", fmt.Errorf("invalid fragment '%s': %w", fragment, err)
+	}
+	if ptr != "" && !strings.HasPrefix(ptr, "/") {
+		ptr = "/" + ptr
+	}
+	return ptr, nil
+}
+
+func unescapePointerToken(token string) string {
+	token = strings.ReplaceAll(token, "~1", "/")
+	return strings.ReplaceAll(token, "~0", "~")
+}
+
+// resolvePointer returns the part of doc referenced by the JSON pointer ptr.
+func resolvePointer(doc any, ptr string) (any, error) {
+	tokens, err := parsePointer(ptr)
+	if err != nil {
+		return nil, err
+	}
+	current := doc
+	for i, token := range tokens {
+		switch c := current.(type) {
+		case *Object:
+			next, ok := c.Get(token)
+			if !ok {
+				return nil, fmt.Errorf("json pointer '%s': member '%s' not found", ptr, token)
+			}
+			current = next
+		case []any:
+			idx, err := arrayIndex(token, len(c))
+			if err != nil {
+				return nil, fmt.Errorf("json pointer '%s': %w", ptr, err)
+			}
+			current = c[idx]
+		default:
+			return nil, fmt.Errorf("json pointer '%s': cannot descend into %T at token %d", ptr, current, i)
+		}
+	}
+	return current, nil
+}
+
+func arrayIndex(token string, length int) (int, error) {
+	if token == "-" {
+		return 0, fmt.Errorf("array index '-' references a nonexistent element")
+	}
+	if len(token) > 1 && token[0] == '0' {
+		return 0, fmt.Errorf("array index '%s' must not have leading zeros", token)
+	}
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx < 0 {
+		return 0, fmt.Errorf("invalid array index '%s'", token)
+	}
+	if idx >= length {
+		return 0, fmt.Errorf("array index %d out of range", idx)
+	}
+	return idx, nil
+}
+
+// removePointer deletes the member of doc referenced by ptr.
+func removePointer(doc any, ptr string) error {
+	tokens, err := parsePointer(ptr)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return fmt.Errorf("the whole document can't be removed")
+	}
+	parentPtr := ""
+	for _, t := range tokens[:len(tokens)-1] {
+		parentPtr += "/" + escapePointerToken(t)
+	}
+	parent, err := resolvePointer(doc, parentPtr)
+	if err != nil {
+		return err
+	}
+	last := tokens[len(tokens)-1]
+	parentMap, ok := parent.(*Object)
+	if !ok {
+		return fmt.Errorf("json pointer '%s': only members of objects can be removed", ptr)
+	}
+	if !parentMap.Has(last) {
+		return fmt.Errorf("json pointer '%s': member '%s' not found", ptr, last)
+	}
+	parentMap.Delete(last)
+	return nil
+}
+
+func escapePointerToken(token string) string {
+	token = strings.ReplaceAll(token, "~", "~0")
+	return strings.ReplaceAll(token, "/", "~1")
+}
@@ -0,0 +1,1132 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// JSON-LD processing of the generated TDs. It implements the parts of
+// the JSON-LD 1.1 expansion and compaction algorithms used by TDs:
+// prefixes, @vocab, typed and @vocab terms, @set, @list, @language
+// and @index containers (including property-valued indexes) and
+// property- and type-scoped contexts.
+
+const (
+	JSONLDExpand  = "expand"
+	JSONLDCompact = "compact"
+)
+
+//go:generate go run fetchcontexts.go
+
+//go:embed context
+var bundledContextFiles embed.FS
+
+// contextSources maps the URLs of the bundled contexts to the files of
+// their copies in the context directory, go generate downloads them
+// again from these URLs.
+const contextSources = "context/sources.json"
+
+var bundledContexts = sync.OnceValue(func() map[string]string {
+	sources := make(map[string]string)
+	content, err := bundledContextFiles.ReadFile(contextSources)
+	if err == nil {
+		err = json.Unmarshal(content, &sources)
+	}
+	if err != nil {
+		slog.Warn("unable to read the list of bundled contexts", "error", err)
+	}
+	return sources
+})
+
+// namespacesWithoutContext are vocabularies without a published JSON-LD
+// context, they are used with a prefix like {"hctl": "<namespace>#"}
+var namespacesWithoutContext = []string{
+	"https://www.w3.org/2019/wot/hypermedia",
+}
+
+// maxRemoteContexts limits the nesting of contexts loaded by URL
+const maxRemoteContexts = 10
+
+var jsonldKeywords = []string{"@base", "@container", "@context", "@direction", "@graph", "@id", "@import", "@included",
+	"@index", "@json", "@language", "@list", "@nest", "@none", "@prefix", "@propagate", "@protected", "@reverse",
+	"@set", "@type", "@value", "@version", "@vocab"}
+
+var (
+	keywordLikePattern  = regexp.MustCompile(`^@[a-zA-Z]+$`)
+	absoluteIRIPattern  = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*:`)
+	contextOnlyKeywords = []string{"@base", "@direction", "@import", "@language", "@propagate", "@protected", "@version", "@vocab"}
+)
+
+func isKeyword(s string) bool {
+	return slices.Contains(jsonldKeywords, s)
+}
+
+// ldTerm is the definition of a term in an active context
+type ldTerm struct {
+	id        string
+	typ       string
+	container []string
+	// property of a property-valued index
+	index      string
+	context    any
+	hasContext bool
+	prefix     bool
+}
+
+func (t *ldTerm) hasContainer(c string) bool {
+	return t != nil && slices.Contains(t.container, c)
+}
+
+// ldContext is an active context. A nil term marks a term explicitly
+// mapped to null.
+type ldContext struct {
+	terms    map[string]*ldTerm
+	vocab    string
+	base     string
+	language string
+	// context before a type-scoped context, which is not propagated
+	previous *ldContext
+}
+
+func newLDContext() *ldContext {
+	return &ldContext{terms: make(map[string]*ldTerm)}
+}
+
+func (c *ldContext) clone() *ldContext {
+	n := *c
+	n.terms = make(map[string]*ldTerm, len(c.terms))
+	for k, v := range c.terms {
+		n.terms[k] = v
+	}
+	return &n
+}
+
+func (c *ldContext) term(name string) *ldTerm {
+	return c.terms[name]
+}
+
+// sortedTerms returns the names of the defined terms, shortest first
+func (c *ldContext) sortedTerms() []string {
+	names := make([]string, 0, len(c.terms))
+	for name, t := range c.terms {
+		if t != nil {
+			names = append(names, name)
+		}
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		if len(a) != len(b) {
+			return len(a) - len(b)
+		}
+		return strings.Compare(a, b)
+	})
+	return names
+}
+
+// jsonLD expands and compacts documents, contexts referenced by URL
+// are loaded with load, if they are not bundled.
+type jsonLD struct {
+	load func(url string) (any, error)
+}
+
+func (ld *jsonLD) loadContext(u string) (any, error) {
+	if slices.Contains(namespacesWithoutContext, u) {
+		return nil, fmt.Errorf("%s is a vocabulary without a JSON-LD context, define a prefix for it instead", u)
+	}
+	if file, ok := bundledContexts()[u]; ok {
+		if content, err := bundledContextFiles.ReadFile("context/" + file); err == nil {
+			return decodeJSON(content)
+		}
+	}
+	if ld.load == nil {
+		return nil, fmt.Errorf("context %s is not available", u)
+	}
+	return ld.load(u)
+}
+
+// processContext applies a local context to the active context
+func (ld *jsonLD) processContext(active *ldContext, local any, remotes []string) (*ldContext, error) {
+	result := active.clone()
+	for _, ctx := range asArray(local) {
+		switch c := ctx.(type) {
+		case nil:
+			result = &ldContext{terms: make(map[string]*ldTerm), base: active.base}
+		case string:
+			u := resolveIRI(result.base, c)
+			if slices.Contains(remotes, u) || len(remotes) >= maxRemoteContexts {
+				return nil, fmt.Errorf("recursive context inclusion of %s", u)
+			}
+			doc, err := ld.loadContext(u)
+			if err != nil {
+				return nil, fmt.Errorf("loading context %s: %w", u, err)
+			}
+			docObj, ok := doc.(*Object)
+			if !ok || !docObj.Has("@context") {
+				return nil, fmt.Errorf("%s is not a valid context document", u)
+			}
+			result, err = ld.processContext(result, docObj.Value("@context"), append(remotes, u))
+			if err != nil {
+				return nil, err
+			}
+		case *Object:
+			if err := ld.processContextObject(result, c); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("invalid local context %v", ctx)
+		}
+	}
+	return result, nil
+}
+
+func (ld *jsonLD) processContextObject(result *ldContext, c *Object) error {
+	if v, ok := c.Get("@base"); ok {
+		s, _ := v.(string)
+		result.base = resolveIRI(result.base, s)
+	}
+	if v, ok := c.Get("@vocab"); ok {
+		result.vocab = ""
+		if s, isString := v.(string); isString {
+			vocab, err := ld.expandIRI(result, s, true, true, nil, nil)
+			if err != nil {
+				return err
+			}
+			result.vocab = vocab
+		}
+	}
+	if v, ok := c.Get("@language"); ok {
+		s, _ := v.(string)
+		result.language = strings.ToLower(s)
+	}
+	defined := make(map[string]bool)
+	for _, key := range c.Keys() {
+		if slices.Contains(contextOnlyKeywords, key) {
+			continue
+		}
+		if err := ld.createTerm(result, c, key, defined); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createTerm adds the definition of term in the local context to active
+func (ld *jsonLD) createTerm(active *ldContext, local *Object, term string, defined map[string]bool) error {
+	if done, ok := defined[term]; ok {
+		if done {
+			return nil
+		}
+		return fmt.Errorf("cyclic IRI mapping of term '%s'", term)
+	}
+	defined[term] = false
+	defer func() { defined[term] = true }()
+	if isKeyword(term) {
+		return fmt.Errorf("keyword redefinition of '%s'", term)
+	}
+	if keywordLikePattern.MatchString(term) {
+		return nil
+	}
+	var def *Object
+	simple := false
+	switch v := local.Value(term).(type) {
+	case nil:
+		active.terms[term] = nil
+		return nil
+	case string:
+		def = NewObject()
+		def.Set("@id", v)
+		simple = true
+	case *Object:
+		def = v
+	default:
+		return fmt.Errorf("invalid definition of term '%s'", term)
+	}
+	t := &ldTerm{}
+	idValue, hasID := def.Get("@id")
+	if rev, ok := def.Get("@reverse"); ok {
+		idValue, hasID = rev, true
+	}
+	if hasID && idValue == nil {
+		active.terms[term] = nil
+		return nil
+	}
+	if hasID {
+		s, ok := idValue.(string)
+		if !ok {
+			return fmt.Errorf("invalid IRI mapping of term '%s'", term)
+		}
+		id, err := ld.expandIRI(active, s, false, true, local, defined)
+		if err != nil {
+			return err
+		}
+		if !isKeyword(id) && keywordLikePattern.MatchString(id) {
+			return nil
+		}
+		if !isKeyword(id) && !strings.Contains(id, ":") {
+			return fmt.Errorf("invalid IRI mapping '%s' of term '%s'", id, term)
+		}
+		t.id = id
+		if simple && !strings.ContainsAny(term, ":/") && strings.ContainsAny(id[len(id)-1:], ":/?#[]@") {
+			t.prefix = true
+		}
+	} else if prefix, suffix, found := strings.Cut(term, ":"); found && prefix != "" {
+		if local.Has(prefix) {
+			if err := ld.createTerm(active, local, prefix, defined); err != nil {
+				return err
+			}
+		}
+		if pt := active.term(prefix); pt != nil {
+			t.id = pt.id + suffix
+		} else {
+			t.id = term
+		}
+	} else if term == "@type" {
+		t.id = "@type"
+	} else if active.vocab != "" {
+		t.id = active.vocab + term
+	} else {
+		return fmt.Errorf("term '%s' has no IRI mapping", term)
+	}
+	if v, ok := def.Get("@type"); ok {
+		s, isString := v.(string)
+		if !isString {
+			return fmt.Errorf("invalid type mapping of term '%s'", term)
+		}
+		typ, err := ld.expandIRI(active, s, false, true, local, defined)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains([]string{"@id", "@vocab", "@json", "@none"}, typ) && !absoluteIRIPattern.MatchString(typ) {
+			return fmt.Errorf("invalid type mapping '%s' of term '%s'", typ, term)
+		}
+		t.typ = typ
+	}
+	if v, ok := def.Get("@container"); ok {
+		for _, c := range asArray(v) {
+			if s, isString := c.(string); isString {
+				t.container = append(t.container, s)
+			}
+		}
+	}
+	if v, ok := def.Get("@index"); ok {
+		t.index, _ = v.(string)
+	}
+	if v, ok := def.Get("@context"); ok {
+		t.context, t.hasContext = v, true
+	}
+	if v, ok := def.Get("@prefix"); ok {
+		t.prefix, _ = v.(bool)
+	}
+	active.terms[term] = t
+	return nil
+}
+
+// expandIRI expands a term, compact IRI or relative IRI. vocab selects
+// the expansion of terms and the vocabulary mapping, documentRelative
+// the resolution against the base IRI.
+func (ld *jsonLD) expandIRI(active *ldContext, value string, documentRelative bool, vocab bool, local *Object, defined map[string]bool) (string, error) {
+	if value == "" || isKeyword(value) {
+		return value, nil
+	}
+	if keywordLikePattern.MatchString(value) {
+		return "", nil
+	}
+	if local != nil && local.Has(value) && !defined[value] {
+		if err := ld.createTerm(active, local, value, defined); err != nil {
+			return "", err
+		}
+	}
+	if vocab {
+		if t, ok := active.terms[value]; ok {
+			if t == nil {
+				return "", nil
+			}
+			return t.id, nil
+		}
+	}
+	if prefix, suffix, found := strings.Cut(value, ":"); found && prefix != "" {
+		if prefix == "_" || strings.HasPrefix(suffix, "//") {
+			return value, nil
+		}
+		if local != nil && local.Has(prefix) && !defined[prefix] {
+			if err := ld.createTerm(active, local, prefix, defined); err != nil {
+				return "", err
+			}
+		}
+		if t := active.term(prefix); t != nil && t.prefix {
+			return t.id + suffix, nil
+		}
+		if absoluteIRIPattern.MatchString(value) {
+			return value, nil
+		}
+	}
+	if vocab && active.vocab != "" {
+		return active.vocab + value, nil
+	}
+	if documentRelative {
+		return resolveIRI(active.base, value), nil
+	}
+	return value, nil
+}
+
+func resolveIRI(base string, ref string) string {
+	if base == "" || absoluteIRIPattern.MatchString(ref) {
+		return ref
+	}
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return b.ResolveReference(r).String()
+}
+
+// Expand returns the expanded form of a JSON-LD document
+func (ld *jsonLD) Expand(doc any) ([]any, error) {
+	res, err := ld.expand(newLDContext(), "", doc)
+	if err != nil {
+		return nil, err
+	}
+	if o, ok := res.(*Object); ok && o.Len() == 1 && o.Has("@graph") {
+		res = o.Value("@graph")
+	}
+	return asArray(res), nil
+}
+
+func (ld *jsonLD) expand(active *ldContext, activeProperty string, element any) (any, error) {
+	switch e := element.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		res := make([]any, 0, len(e))
+		t := active.term(activeProperty)
+		for _, item := range e {
+			v, err := ld.expand(active, activeProperty, item)
+			if err != nil {
+				return nil, err
+			}
+			if a, isArray := v.([]any); isArray && t.hasContainer("@list") {
+				v = listObject(a)
+			}
+			if a, isArray := v.([]any); isArray {
+				res = append(res, a...)
+			} else if v != nil {
+				res = append(res, v)
+			}
+		}
+		return res, nil
+	case *Object:
+		return ld.expandObject(active, activeProperty, e)
+	default:
+		if activeProperty == "" || activeProperty == "@graph" {
+			return nil, nil
+		}
+		if t := active.term(activeProperty); t != nil && t.hasContext {
+			var err error
+			active, err = ld.processContext(active, t.context, nil)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return ld.expandValue(active, activeProperty, e)
+	}
+}
+
+func listObject(items []any) *Object {
+	o := NewObject()
+	o.Set("@list", items)
+	return o
+}
+
+func (ld *jsonLD) expandObject(active *ldContext, activeProperty string, obj *Object) (any, error) {
+	propertyTerm := active.term(activeProperty)
+	if active.previous != nil && !obj.Has("@value") && !(obj.Len() == 1 && obj.Has("@id")) {
+		active = active.previous
+	}
+	var err error
+	if propertyTerm != nil && propertyTerm.hasContext {
+		if active, err = ld.processContext(active, propertyTerm.context, nil); err != nil {
+			return nil, err
+		}
+	}
+	if ctx, ok := obj.Get("@context"); ok {
+		if active, err = ld.processContext(active, ctx, nil); err != nil {
+			return nil, err
+		}
+	}
+	typeScoped := active
+	if active, err = ld.applyTypeScopedContexts(active, obj); err != nil {
+		return nil, err
+	}
+	result := NewObject()
+	for _, key := range obj.Keys() {
+		if key == "@context" {
+			continue
+		}
+		value := obj.Value(key)
+		prop, err := ld.expandIRI(active, key, false, true, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if prop == "" || (!strings.Contains(prop, ":") && !isKeyword(prop)) {
+			continue
+		}
+		if isKeyword(prop) {
+			if err := ld.expandKeyword(active, typeScoped, activeProperty, result, prop, value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		expanded, err := ld.expandProperty(active, key, value)
+		if err != nil {
+			return nil, err
+		}
+		if expanded == nil {
+			continue
+		}
+		if t := active.term(key); t.hasContainer("@list") {
+			if o, isObj := expanded.(*Object); !isObj || !o.Has("@list") {
+				expanded = listObject(asArray(expanded))
+			}
+		}
+		existing, _ := result.Value(prop).([]any)
+		result.Set(prop, append(existing, asArray(expanded)...))
+	}
+	if v, ok := result.Get("@value"); ok {
+		if v == nil {
+			return nil, nil
+		}
+		if types, isArray := result.Value("@type").([]any); isArray && len(types) == 1 {
+			result.Set("@type", types[0])
+		}
+	} else if set, ok := result.Get("@set"); ok {
+		return set, nil
+	}
+	if result.Len() == 1 && result.Has("@language") {
+		return nil, nil
+	}
+	if activeProperty == "" || activeProperty == "@graph" {
+		if result.Len() == 0 || result.Has("@value") || result.Has("@list") {
+			return nil, nil
+		}
+		if result.Len() == 1 && result.Has("@id") {
+			return nil, nil
+		}
+	}
+	return result, nil
+}
+
+// applyTypeScopedContexts applies the contexts of the terms used as
+// @type of obj. They are not propagated to nested nodes.
+func (ld *jsonLD) applyTypeScopedContexts(active *ldContext, obj *Object) (*ldContext, error) {
+	types := make([]string, 0)
+	for _, key := range obj.Keys() {
+		prop, err := ld.expandIRI(active, key, false, true, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if prop != "@type" {
+			continue
+		}
+		for _, t := range asArray(obj.Value(key)) {
+			if s, ok := t.(string); ok {
+				types = append(types, s)
+			}
+		}
+	}
+	slices.Sort(types)
+	res := active
+	for _, typ := range types {
+		if t := active.term(typ); t != nil && t.hasContext {
+			var err error
+			if res, err = ld.processContext(res, t.context, nil); err != nil {
+				return nil, err
+			}
+			res.previous = active
+		}
+	}
+	return res, nil
+}
+
+func (ld *jsonLD) expandKeyword(active *ldContext, typeScoped *ldContext, activeProperty string, result *Object, keyword string, value any) error {
+	switch keyword {
+	case "@id":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("invalid @id value %v", value)
+		}
+		id, err := ld.expandIRI(active, s, true, false, nil, nil)
+		if err != nil {
+			return err
+		}
+		result.Set("@id", id)
+	case "@type":
+		types := make([]any, 0)
+		for _, t := range asArray(value) {
+			s, ok := t.(string)
+			if !ok {
+				return fmt.Errorf("invalid @type value %v", value)
+			}
+			typ, err := ld.expandIRI(typeScoped, s, true, true, nil, nil)
+			if err != nil {
+				return err
+			}
+			types = append(types, typ)
+		}
+		existing, _ := result.Value("@type").([]any)
+		result.Set("@type", append(existing, types...))
+	case "@graph":
+		v, err := ld.expand(active, "@graph", value)
+		if err != nil {
+			return err
+		}
+		result.Set("@graph", asArray(v))
+	case "@value":
+		result.Set("@value", value)
+	case "@language":
+		s, _ := value.(string)
+		result.Set("@language", strings.ToLower(s))
+	case "@index":
+		result.Set("@index", value)
+	case "@list":
+		if activeProperty == "" || activeProperty == "@graph" {
+			return nil
+		}
+		v, err := ld.expand(active, activeProperty, value)
+		if err != nil {
+			return err
+		}
+		result.Set("@list", asArray(v))
+	case "@set":
+		v, err := ld.expand(active, activeProperty, value)
+		if err != nil {
+			return err
+		}
+		result.Set("@set", asArray(v))
+	}
+	// @reverse, @included, @nest and @direction are not used by TDs
+	return nil
+}
+
+// expandProperty expands the value of a member, which is not a keyword
+func (ld *jsonLD) expandProperty(active *ldContext, key string, value any) (any, error) {
+	t := active.term(key)
+	if t != nil && t.typ == "@json" {
+		o := NewObject()
+		o.Set("@value", value)
+		o.Set("@type", "@json")
+		return o, nil
+	}
+	valueObj, isObj := value.(*Object)
+	switch {
+	case isObj && t.hasContainer("@language"):
+		res := make([]any, 0, valueObj.Len())
+		for _, lang := range valueObj.Keys() {
+			for _, item := range asArray(valueObj.Value(lang)) {
+				if item == nil {
+					continue
+				}
+				o := NewObject()
+				o.Set("@value", item)
+				if lang != "@none" {
+					o.Set("@language", strings.ToLower(lang))
+				}
+				res = append(res, o)
+			}
+		}
+		return res, nil
+	case isObj && (t.hasContainer("@index") || t.hasContainer("@id")):
+		res := make([]any, 0, valueObj.Len())
+		for _, idx := range valueObj.Keys() {
+			v, err := ld.expand(active, key, asArray(valueObj.Value(idx)))
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range asArray(v) {
+				if itemObj, ok := item.(*Object); ok && idx != "@none" {
+					if err := ld.addIndex(active, t, itemObj, idx); err != nil {
+						return nil, err
+					}
+				}
+				res = append(res, item)
+			}
+		}
+		return res, nil
+	default:
+		return ld.expand(active, key, value)
+	}
+}
+
+func (ld *jsonLD) addIndex(active *ldContext, t *ldTerm, item *Object, idx string) error {
+	switch {
+	case t.hasContainer("@id"):
+		if !item.Has("@id") {
+			id, err := ld.expandIRI(active, idx, true, false, nil, nil)
+			if err != nil {
+				return err
+			}
+			item.Set("@id", id)
+		}
+	case t.index != "":
+		prop, err := ld.expandIRI(active, t.index, false, true, nil, nil)
+		if err != nil {
+			return err
+		}
+		indexValue := NewObject()
+		indexValue.Set("@value", idx)
+		existing, _ := item.Value(prop).([]any)
+		item.Set(prop, append([]any{indexValue}, existing...))
+	case !item.Has("@index"):
+		item.Set("@index", idx)
+	}
+	return nil
+}
+
+func (ld *jsonLD) expandValue(active *ldContext, activeProperty string, value any) (any, error) {
+	t := active.term(activeProperty)
+	if s, isString := value.(string); isString && t != nil && (t.typ == "@id" || t.typ == "@vocab") {
+		id, err := ld.expandIRI(active, s, true, t.typ == "@vocab", nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		o := NewObject()
+		o.Set("@id", id)
+		return o, nil
+	}
+	o := NewObject()
+	o.Set("@value", value)
+	if t != nil && t.typ != "" && t.typ != "@id" && t.typ != "@vocab" && t.typ != "@none" {
+		o.Set("@type", t.typ)
+	} else if _, isString := value.(string); isString && active.language != "" {
+		o.Set("@language", active.language)
+	}
+	return o, nil
+}
+
+// Compact compacts an expanded document with the context ctx, which
+// is added as @context to the result.
+func (ld *jsonLD) Compact(expanded []any, ctx any) (*Object, error) {
+	active, err := ld.processContext(newLDContext(), ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	compacted, err := ld.compact(active, "", expanded)
+	if err != nil {
+		return nil, err
+	}
+	res := NewObject()
+	if ctx != nil {
+		res.Set("@context", ctx)
+	}
+	switch c := compacted.(type) {
+	case *Object:
+		for _, key := range c.Keys() {
+			res.Set(key, c.Value(key))
+		}
+	case []any:
+		if len(c) > 0 {
+			res.Set(ld.alias(active, "@graph"), c)
+		}
+	}
+	return res, nil
+}
+
+func (ld *jsonLD) compact(active *ldContext, activeProperty string, element any) (any, error) {
+	switch e := element.(type) {
+	case []any:
+		res := make([]any, 0, len(e))
+		for _, item := range e {
+			c, err := ld.compact(active, activeProperty, item)
+			if err != nil {
+				return nil, err
+			}
+			if c != nil {
+				res = append(res, c)
+			}
+		}
+		t := active.term(activeProperty)
+		if len(res) == 1 && !t.hasContainer("@list") && !t.hasContainer("@set") {
+			return res[0], nil
+		}
+		return res, nil
+	case *Object:
+		return ld.compactObject(active, activeProperty, e)
+	default:
+		return e, nil
+	}
+}
+
+func (ld *jsonLD) compactObject(active *ldContext, activeProperty string, obj *Object) (any, error) {
+	propertyTerm := active.term(activeProperty)
+	if active.previous != nil && !obj.Has("@value") && !(obj.Len() == 1 && obj.Has("@id")) {
+		active = active.previous
+	}
+	var err error
+	if propertyTerm != nil && propertyTerm.hasContext {
+		if active, err = ld.processContext(active, propertyTerm.context, nil); err != nil {
+			return nil, err
+		}
+	}
+	if obj.Has("@value") || (obj.Len() == 1 && obj.Has("@id")) {
+		return ld.compactValue(active, activeProperty, obj)
+	}
+	inputActive := active
+	if types, ok := obj.Value("@type").([]any); ok {
+		compactedTypes := make([]string, 0, len(types))
+		for _, typ := range types {
+			s, _ := typ.(string)
+			compactedTypes = append(compactedTypes, ld.compactIRI(inputActive, s, true))
+		}
+		slices.Sort(compactedTypes)
+		for _, typ := range compactedTypes {
+			if t := inputActive.term(typ); t != nil && t.hasContext {
+				if active, err = ld.processContext(active, t.context, nil); err != nil {
+					return nil, err
+				}
+				active.previous = inputActive
+			}
+		}
+	}
+	result := NewObject()
+	for _, prop := range obj.Keys() {
+		value := obj.Value(prop)
+		switch prop {
+		case "@id":
+			s, _ := value.(string)
+			result.Set(ld.alias(active, "@id"), ld.compactIRI(active, s, false))
+		case "@type":
+			types := make([]any, 0)
+			for _, typ := range asArray(value) {
+				s, _ := typ.(string)
+				types = append(types, ld.compactIRI(inputActive, s, true))
+			}
+			alias := ld.alias(active, "@type")
+			if len(types) == 1 && !active.term(alias).hasContainer("@set") {
+				result.Set(alias, types[0])
+			} else {
+				result.Set(alias, types)
+			}
+		case "@index", "@language":
+			result.Set(ld.alias(active, prop), value)
+		case "@graph", "@list":
+			c, err := ld.compact(active, activeProperty, value)
+			if err != nil {
+				return nil, err
+			}
+			result.Set(ld.alias(active, prop), asArray(c))
+		case "@reverse":
+		default:
+			if err := ld.compactProperty(active, result, prop, asArray(value)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return result, nil
+}
+
+func (ld *jsonLD) compactProperty(active *ldContext, result *Object, prop string, items []any) error {
+	if len(items) == 0 {
+		result.Set(ld.selectTerm(active, prop, nil), []any{})
+		return nil
+	}
+	for _, item := range items {
+		term := ld.selectTerm(active, prop, item)
+		t := active.term(term)
+		itemObj, isObj := item.(*Object)
+		switch {
+		case isObj && itemObj.Has("@list") && t.hasContainer("@list"):
+			c, err := ld.compact(active, term, itemObj.Value("@list"))
+			if err != nil {
+				return err
+			}
+			result.Set(term, asArray(c))
+		case isObj && t.hasContainer("@language") && itemObj.Has("@language"):
+			m, _ := result.Value(term).(*Object)
+			if m == nil {
+				m = NewObject()
+				result.Set(term, m)
+			}
+			lang, _ := itemObj.Value("@language").(string)
+			addMember(m, lang, itemObj.Value("@value"))
+		case isObj && t.hasContainer("@index"):
+			key, rest := ld.indexKey(active, t, itemObj)
+			c, err := ld.compact(active, term, rest)
+			if err != nil {
+				return err
+			}
+			m, _ := result.Value(term).(*Object)
+			if m == nil {
+				m = NewObject()
+				result.Set(term, m)
+			}
+			addMember(m, key, c)
+		default:
+			c, err := ld.compact(active, term, item)
+			if err != nil {
+				return err
+			}
+			existing, found := result.Get(term)
+			switch {
+			case found:
+				result.Set(term, append(asArray(existing), c))
+			case t.hasContainer("@set") || t.hasContainer("@list"):
+				result.Set(term, []any{c})
+			default:
+				result.Set(term, c)
+			}
+		}
+	}
+	return nil
+}
+
+func addMember(m *Object, key string, value any) {
+	if existing, found := m.Get(key); found {
+		m.Set(key, append(asArray(existing), value))
+	} else {
+		m.Set(key, value)
+	}
+}
+
+// indexKey returns the key of an item in an index map and the item
+// without the index
+func (ld *jsonLD) indexKey(active *ldContext, t *ldTerm, item *Object) (string, *Object) {
+	rest := item.Clone()
+	if t.index == "" {
+		key, ok := item.Value("@index").(string)
+		if !ok {
+			return "@none", rest
+		}
+		rest.Delete("@index")
+		return key, rest
+	}
+	prop, _ := ld.expandIRI(active, t.index, false, true, nil, nil)
+	values, _ := item.Value(prop).([]any)
+	for i, v := range values {
+		vo, ok := v.(*Object)
+		if !ok || vo.Len() != 1 {
+			continue
+		}
+		if key, isString := vo.Value("@value").(string); isString {
+			if remaining := slices.Delete(slices.Clone(values), i, i+1); len(remaining) > 0 {
+				rest.Set(prop, remaining)
+			} else {
+				rest.Delete(prop)
+			}
+			return key, rest
+		}
+	}
+	return "@none", rest
+}
+
+func (ld *jsonLD) compactValue(active *ldContext, activeProperty string, obj *Object) (any, error) {
+	t := active.term(activeProperty)
+	if obj.Len() == 1 && obj.Has("@id") {
+		id, _ := obj.Value("@id").(string)
+		if t != nil && (t.typ == "@id" || t.typ == "@vocab") {
+			return ld.compactIRI(active, id, t.typ == "@vocab"), nil
+		}
+		res := NewObject()
+		res.Set(ld.alias(active, "@id"), ld.compactIRI(active, id, false))
+		return res, nil
+	}
+	value := obj.Value("@value")
+	typ, hasType := obj.Value("@type").(string)
+	lang, hasLang := obj.Value("@language").(string)
+	members := obj.Len()
+	if obj.Has("@index") && t.hasContainer("@index") {
+		members--
+	}
+	switch {
+	case hasType && members == 2 && t != nil && t.typ == typ:
+		return value, nil
+	case hasLang && members == 2 && lang == active.language && (t == nil || t.typ == ""):
+		return value, nil
+	case !hasType && !hasLang && members == 1 && (t == nil || t.typ == "" || t.typ == "@none"):
+		if _, isString := value.(string); !isString || active.language == "" {
+			return value, nil
+		}
+	}
+	res := NewObject()
+	for _, key := range obj.Keys() {
+		v := obj.Value(key)
+		if key == "@type" {
+			v = ld.compactIRI(active, typ, true)
+		}
+		res.Set(ld.alias(active, key), v)
+	}
+	return res, nil
+}
+
+// selectTerm finds the term to compact the property iri with the given value
+func (ld *jsonLD) selectTerm(active *ldContext, iri string, value any) string {
+	best, bestScore := "", -1
+	for _, name := range active.sortedTerms() {
+		t := active.term(name)
+		if t.id != iri {
+			continue
+		}
+		if score := ld.termScore(active, t, value); score > bestScore {
+			best, bestScore = name, score
+		}
+	}
+	if best != "" {
+		return best
+	}
+	return ld.compactIRI(active, iri, true)
+}
+
+// termScore rates how well a term fits a value, -1 if the term can't
+// represent the value
+func (ld *jsonLD) termScore(active *ldContext, t *ldTerm, value any) int {
+	obj, isObj := value.(*Object)
+	if !isObj {
+		if len(t.container) == 0 && t.typ == "" {
+			return 1
+		}
+		return 0
+	}
+	if obj.Has("@list") {
+		if t.hasContainer("@list") {
+			return 3
+		}
+		if len(t.container) == 0 {
+			return 0
+		}
+		return -1
+	}
+	if t.hasContainer("@list") {
+		return -1
+	}
+	bonus := 0
+	if t.hasContainer("@index") {
+		if t.index != "" {
+			prop, _ := ld.expandIRI(active, t.index, false, true, nil, nil)
+			if !obj.Has(prop) {
+				return -1
+			}
+		} else if !obj.Has("@index") {
+			return -1
+		}
+		bonus = 1
+	}
+	if t.hasContainer("@language") {
+		if !obj.Has("@language") {
+			return -1
+		}
+		bonus = 1
+	}
+	if !obj.Has("@value") {
+		switch t.typ {
+		case "@vocab":
+			// prefer the term whose scoped context defines the value
+			if id, isString := obj.Value("@id").(string); isString && t.hasContext {
+				if scoped, err := ld.processContext(active, t.context, nil); err == nil && ld.definesTerm(scoped, id) {
+					bonus++
+				}
+			}
+			return 2 + bonus
+		case "@id":
+			return 2 + bonus
+		case "":
+			return 1 + bonus
+		}
+		return -1
+	}
+	if typ, hasType := obj.Value("@type").(string); hasType {
+		switch t.typ {
+		case typ:
+			return 2 + bonus
+		case "":
+			return bonus
+		}
+		return -1
+	}
+	if t.typ == "" || t.typ == "@none" {
+		return 2 + bonus
+	}
+	return -1
+}
+
+// definesTerm checks if a term of active is mapped to iri
+func (ld *jsonLD) definesTerm(active *ldContext, iri string) bool {
+	for _, t := range active.terms {
+		if t != nil && t.id == iri {
+			return true
+		}
+	}
+	return false
+}
+
+// compactIRI shortens an IRI to a term, compact IRI or vocabulary relative IRI
+func (ld *jsonLD) compactIRI(active *ldContext, iri string, vocab bool) string {
+	if isKeyword(iri) {
+		return ld.alias(active, iri)
+	}
+	names := active.sortedTerms()
+	if vocab {
+		for _, name := range names {
+			if t := active.term(name); t.id == iri && t.typ == "" && len(t.container) == 0 {
+				return name
+			}
+		}
+		if active.vocab != "" && strings.HasPrefix(iri, active.vocab) {
+			suffix := iri[len(active.vocab):]
+			if _, defined := active.terms[suffix]; suffix != "" && !defined && !strings.Contains(suffix, ":") {
+				return suffix
+			}
+		}
+	}
+	best := ""
+	for _, name := range names {
+		t := active.term(name)
+		if !t.prefix || !strings.HasPrefix(iri, t.id) || len(iri) == len(t.id) {
+			continue
+		}
+		candidate := name + ":" + iri[len(t.id):]
+		if ct := active.term(candidate); ct != nil && ct.id != iri {
+			continue
+		}
+		if best == "" || len(candidate) < len(best) {
+			best = candidate
+		}
+	}
+	if best != "" {
+		return best
+	}
+	return iri
+}
+
+// alias returns the term defined for a keyword
+func (ld *jsonLD) alias(active *ldContext, keyword string) string {
+	for _, name := range active.sortedTerms() {
+		if active.term(name).id == keyword {
+			return name
+		}
+	}
+	return keyword
+}
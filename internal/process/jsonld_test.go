@@ -0,0 +1,70 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"testing"
+)
+
+// TestBundledContexts loads every context of sources.json without a
+// loader, i.e. offline
+func TestBundledContexts(t *testing.T) {
+	ld := &jsonLD{}
+	if len(bundledContexts()) == 0 {
+		t.Fatal("no bundled contexts")
+	}
+	for u := range bundledContexts() {
+		doc, err := ld.loadContext(u)
+		if err != nil {
+			t.Errorf("load %s: %v", u, err)
+			continue
+		}
+		if obj, ok := doc.(*Object); !ok || !obj.Has("@context") {
+			t.Errorf("%s is not a context document", u)
+		}
+	}
+}
+
+func TestExpandBundledContexts(t *testing.T) {
+	doc, err := decodeJSON([]byte(`{
+		"@context": ["https://www.w3.org/2022/wot/td/v1.1", "http://www.w3.org/ns/sosa/",
+			"http://www.ontology-of-units-of-measure.org/resource/om-2/"],
+		"@type": ["Thing", "sosa:Sensor"],
+		"title": "Thermometer",
+		"properties": {"temperature": {"type": "number", "unit": "om:degreeCelsius"}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expanded, err := (&jsonLD{}).Expand(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	thing, _ := expanded[0].(*Object)
+	types, _ := thing.Value("@type").([]any)
+	want := []any{"https://www.w3.org/2019/wot/td#Thing", "http://www.w3.org/ns/sosa/Sensor"}
+	if len(DiffDocuments(types, want)) > 0 {
+		t.Errorf("got the types %v, want %v", types, want)
+	}
+}
+
+func TestRejectNamespaceWithoutContext(t *testing.T) {
+	doc, _ := decodeJSON([]byte(`{"@context": "https://www.w3.org/2019/wot/hypermedia", "title": "x"}`))
+	if _, err := (&jsonLD{}).Expand(doc); err == nil {
+		t.Error("expanding with the hypermedia namespace as context succeeded")
+	}
+}
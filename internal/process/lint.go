@@ -0,0 +1,285 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Severity of a lint finding
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+)
+
+// LintRule describes a check of the linter
+type LintRule struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Severity    Severity `json:"severity"`
+	Description string   `json:"description"`
+}
+
+// Finding is a problem found by a lint rule
+type Finding struct {
+	RuleID   string   `json:"ruleId"`
+	Severity Severity `json:"severity"`
+	File     string   `json:"file"`
+	Pointer  string   `json:"pointer"`
+	Message  string   `json:"message"`
+}
+
+// LintRules is the catalogue of all rules checked by the linter
+var LintRules = []LintRule{
+	{ID: "TM001", Name: "thing-model-type", Severity: SeverityError,
+		Description: "@type must contain tm:ThingModel"},
+	{ID: "TM002", Name: "model-version", Severity: SeverityWarning,
+		Description: "version.model should declare the version of the model"},
+	{ID: "TM003", Name: "unknown-link-rel", Severity: SeverityWarning,
+		Description: "the rel of a link should be a tm: relation or a registered link relation"},
+	{ID: "TM004", Name: "unresolvable-ref", Severity: SeverityError,
+		Description: "the target of a tm:ref must exist"},
+	{ID: "TM005", Name: "unresolvable-link", Severity: SeverityError,
+		Description: "the models referenced by tm:extends and tm:submodel must exist"},
+	{ID: "TM006", Name: "invalid-placeholder", Severity: SeverityError,
+		Description: "double curly braces must enclose a valid placeholder like {{name}}"},
+	{ID: "TM007", Name: "duplicate-instance-name", Severity: SeverityError,
+		Description: "the instanceName of submodels must be unique"},
+	{ID: "TM008", Name: "missing-forms", Severity: SeverityInfo,
+		Description: "affordances without forms need forms to be added for a valid TD"},
+}
+
+// knownRelations are the tm: relations and registered link relations used in TDs
+var knownRelations = []string{
+	"tm:extends", "tm:submodel", "type", "collection", "item", "alternate", "author",
+	"canonical", "controlledBy", "describedby", "help", "icon", "license", "manifest",
+	"next", "prev", "proxy-to", "related", "self", "service-doc", "service-desc", "up", "via",
+}
+
+// Linter checks thing models for problems before transpiling them
+type Linter struct {
+	p        *Processor
+	disabled []string
+}
+
+// NewLinter creates a linter resolving references like the processor
+// with the search path searchPath. Rules are disabled by ID or name.
+func NewLinter(searchPath string, resolver Resolver, disabled []string) *Linter {
+	p := &Processor{settings: settings{resolver: resolver}, loaded: &loadedFiles{}}
+	p.SetInputPath(searchPath)
+	return &Linter{p: p, disabled: disabled}
+}
+
+// Files returns all model files in the search path
+func (l *Linter) Files() ([]string, error) {
+	files := make([]string, 0)
+	for _, rootDir := range l.p.inputPath {
+		if rootDir == "" {
+			rootDir = "."
+		}
+		err := filepath.Walk(rootDir, func(path string, info os.FileInfo, e1 error) error {
+			if IsNil(info) {
+				logErr("directory did not exist", "path", path)
+				return nil
+			}
+			if e1 != nil {
+				return e1
+			}
+			if !info.IsDir() && isModelFile(path) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// Lint checks the given file with all enabled rules. Files, which don't
+// exist relative to the working directory, are searched in the search path.
+func (l *Linter) Lint(filename string) ([]Finding, error) {
+	href := filename
+	if _, err := os.Stat(filename); err == nil {
+		if href, err = filepath.Abs(filename); err != nil {
+			return nil, err
+		}
+	}
+	data, location, err := l.p.loadFile(href, "")
+	if err != nil {
+		return nil, err
+	}
+	lc := &lintContext{linter: l, file: filename, location: location, doc: data, findings: make([]Finding, 0)}
+	lc.checkDocument()
+	lc.walk(data, "")
+	return lc.findings, nil
+}
+
+func (l *Linter) enabled(rule LintRule) bool {
+	return !slices.Contains(l.disabled, rule.ID) && !slices.Contains(l.disabled, rule.Name)
+}
+
+// HasErrors reports if a finding has the severity error
+func HasErrors(findings []Finding) bool {
+	return slices.ContainsFunc(findings, func(f Finding) bool { return f.Severity == SeverityError })
+}
+
+// lintContext holds the state while linting a single document
+type lintContext struct {
+	linter   *Linter
+	file     string
+	location string
+	doc      any
+	findings []Finding
+}
+
+func (lc *lintContext) report(id string, ptr string, format string, args ...any) {
+	idx := slices.IndexFunc(LintRules, func(r LintRule) bool { return r.ID == id })
+	rule := LintRules[idx]
+	if !lc.linter.enabled(rule) {
+		return
+	}
+	lc.findings = append(lc.findings, Finding{
+		RuleID:   rule.ID,
+		Severity: rule.Severity,
+		File:     lc.file,
+		Pointer:  ptr,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// checkDocument runs the rules on the top level members
+func (lc *lintContext) checkDocument() {
+	rootMap, ok := lc.doc.(*Object)
+	if !ok {
+		lc.report("TM001", "", "the model is not a json object")
+		return
+	}
+	if !rootMap.Has("@type") {
+		lc.report("TM001", "", "@type is missing")
+	} else if !IsThingModel(rootMap) {
+		lc.report("TM001", "/@type", "@type '%v' does not contain tm:ThingModel", rootMap.Value("@type"))
+	}
+	version, _ := rootMap.Value("version").(*Object)
+	if !version.Has("model") {
+		lc.report("TM002", "/version", "version.model is missing")
+	}
+	links, _ := rootMap.Value("links").([]any)
+	instances := make(map[string]int)
+	for i, l := range links {
+		link, ok := l.(*Object)
+		if !ok {
+			continue
+		}
+		ptr := fmt.Sprintf("/links/%d", i)
+		rel, _ := link.Value("rel").(string)
+		href, _ := link.Value("href").(string)
+		if !slices.Contains(knownRelations, rel) {
+			lc.report("TM003", ptr+"/rel", "unknown link relation '%s'", rel)
+		}
+		if rel != "tm:extends" && rel != "tm:submodel" {
+			continue
+		}
+		if _, _, err := lc.linter.p.loadFile(href, lc.location); err != nil {
+			lc.report("TM005", ptr+"/href", "%s: %v", rel, err)
+		}
+		if rel == "tm:submodel" {
+			name, _ := link.Value("instanceName").(string)
+			if first, found := instances[name]; found {
+				lc.report("TM007", ptr+"/instanceName", "instanceName '%s' is already used by /links/%d", name, first)
+			} else {
+				instances[name] = i
+			}
+		}
+	}
+	for _, section := range []string{"properties", "actions", "events"} {
+		affordances, _ := rootMap.Value(section).(*Object)
+		for _, name := range affordances.Keys() {
+			affordance, _ := affordances.Value(name).(*Object)
+			forms, _ := affordance.Value("forms").([]any)
+			if len(forms) == 0 && !affordance.Has("tm:ref") {
+				lc.report("TM008", "/"+section+"/"+escapePointerToken(name), "%s has no forms", name)
+			}
+		}
+	}
+}
+
+// walk runs the rules on all values of the document
+func (lc *lintContext) walk(data any, ptr string) {
+	switch d := data.(type) {
+	case *Object:
+		for _, key := range d.Keys() {
+			childPtr := ptr + "/" + escapePointerToken(key)
+			lc.checkPlaceholders(key, childPtr)
+			if key == "tm:ref" {
+				lc.checkReference(d.Value(key), childPtr)
+				continue
+			}
+			lc.walk(d.Value(key), childPtr)
+		}
+	case []any:
+		for i, element := range d {
+			lc.walk(element, fmt.Sprintf("%s/%d", ptr, i))
+		}
+	case string:
+		lc.checkPlaceholders(d, ptr)
+	}
+}
+
+func (lc *lintContext) checkReference(ref any, ptr string) {
+	refString, ok := ref.(string)
+	if !ok {
+		lc.report("TM004", ptr, "tm:ref must be a string")
+		return
+	}
+	refFile, fragment, _ := strings.Cut(refString, "#")
+	refData := lc.doc
+	if refFile != "" {
+		var err error
+		refData, _, err = lc.linter.p.loadFile(refFile, lc.location)
+		if err != nil {
+			lc.report("TM004", ptr, "%s: %v", refString, err)
+			return
+		}
+	}
+	target, err := fragmentToPointer(fragment)
+	if err == nil {
+		_, err = resolvePointer(refData, target)
+	}
+	if err != nil {
+		lc.report("TM004", ptr, "%s: %v", refString, err)
+	}
+}
+
+// checkPlaceholders reports curly braces, which are not part of a valid placeholder
+func (lc *lintContext) checkPlaceholders(s string, ptr string) {
+	if !strings.Contains(s, "{{") && !strings.Contains(s, "}}") {
+		return
+	}
+	rest := doubleCurlyPattern.ReplaceAllString(s, "")
+	if strings.Contains(rest, "{{") || strings.Contains(rest, "}}") {
+		lc.report("TM006", ptr, "'%s' contains an invalid placeholder", s)
+	}
+}
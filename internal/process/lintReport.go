@@ -0,0 +1,113 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+const (
+	LintFormatText  = "text"
+	LintFormatJSON  = "json"
+	LintFormatSARIF = "sarif"
+
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+)
+
+// WriteFindings writes the findings in the given format
+func WriteFindings(w io.Writer, format string, findings []Finding) error {
+	switch format {
+	case LintFormatText, "":
+		return writeFindingsText(w, findings)
+	case LintFormatJSON:
+		return writeJSON(w, findings)
+	case LintFormatSARIF:
+		return writeJSON(w, sarifLog(findings))
+	default:
+		return fmt.Errorf("unknown lint format '%s', expected one of %s, %s, %s", format, LintFormatText, LintFormatJSON, LintFormatSARIF)
+	}
+}
+
+func writeFindingsText(w io.Writer, findings []Finding) error {
+	for _, f := range findings {
+		_, err := fmt.Fprintf(w, "%s#%s: %s %s %s\n", f.File, f.Pointer, f.Severity, f.RuleID, f.Message)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(v)
+}
+
+// sarifLog builds a SARIF 2.1.0 log with a single run
+func sarifLog(findings []Finding) map[string]any {
+	rules := make([]any, 0, len(LintRules))
+	for _, r := range LintRules {
+		rules = append(rules, map[string]any{
+			"id":                   r.ID,
+			"name":                 r.Name,
+			"shortDescription":     map[string]any{"text": r.Description},
+			"defaultConfiguration": map[string]any{"level": sarifLevel(r.Severity)},
+		})
+	}
+	results := make([]any, 0, len(findings))
+	for _, f := range findings {
+		results = append(results, map[string]any{
+			"ruleId":  f.RuleID,
+			"level":   sarifLevel(f.Severity),
+			"message": map[string]any{"text": f.Message},
+			"locations": []any{map[string]any{
+				"physicalLocation": map[string]any{
+					"artifactLocation": map[string]any{"uri": filepath.ToSlash(f.File)},
+				},
+				"logicalLocations": []any{map[string]any{
+					"fullyQualifiedName": f.Pointer,
+					"kind":               "member",
+				}},
+			}},
+		})
+	}
+	return map[string]any{
+		"$schema": sarifSchema,
+		"version": sarifVersion,
+		"runs": []any{map[string]any{
+			"tool": map[string]any{"driver": map[string]any{
+				"name":           "tmtd",
+				"informationUri": "https://github.com/wot-oss/tmtd",
+				"rules":          rules,
+			}},
+			"results": results,
+		}},
+	}
+}
+
+func sarifLevel(s Severity) string {
+	if s == SeverityInfo {
+		return "note"
+	}
+	return string(s)
+}
@@ -0,0 +1,54 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestLintSearchPath lints all models of the search path like
+// "tmtd lint -s model"
+func TestLintSearchPath(t *testing.T) {
+	l := NewLinter("../../model", NewHTTPResolver(t.TempDir(), true), nil)
+	files, err := l.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(files, "../../model/w3cTest/floor-lamp-1.0.0.tm.jsonld") {
+		t.Fatalf("models of the search path not found, got %v", files)
+	}
+	for _, f := range files {
+		findings, err := l.Lint(f)
+		if err != nil {
+			t.Errorf("lint %s: %v", f, err)
+			continue
+		}
+		for _, finding := range findings {
+			if finding.File != f {
+				t.Errorf("finding %v is reported for %s, want %s", finding, finding.File, f)
+			}
+		}
+	}
+}
+
+func TestLintBareName(t *testing.T) {
+	l := NewLinter("../../model", NewHTTPResolver(t.TempDir(), true), nil)
+	if _, err := l.Lint("dim.jsonld"); err != nil {
+		t.Errorf("lint a model of the search path: %v", err)
+	}
+}
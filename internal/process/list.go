@@ -17,7 +17,6 @@ limitations under the License.
 package process
 
 import (
-	"encoding/json"
 	"fmt"
 	"log/slog"
 	"os"
@@ -27,8 +26,31 @@ import (
 	"github.com/PaesslerAG/jsonpath"
 )
 
-func List(searchPath string) {
+// ModelInfo describes a model found in the search path
+type ModelInfo struct {
+	// Name is the file name without the model extension
+	Name  string `json:"name"`
+	Title string `json:"title"`
+	Path  string `json:"path"`
+}
+
+// modelExtensions are stripped from file names to get model names
+var modelExtensions = []string{".tm.jsonld", ".tm.yaml", ".tm.yml", ".jsonld"}
+
+// ModelName is the name of the model in file path
+func ModelName(path string) string {
+	name := filepath.Base(path)
+	for _, ext := range modelExtensions {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return name
+}
 
+// ListModels returns the models of the search path
+func ListModels(searchPath string) []ModelInfo {
+	models := make([]ModelInfo, 0)
 	inputPath := strings.Split(searchPath, ",")
 	if len(inputPath) == 0 {
 		inputPath = append(inputPath, "model")
@@ -39,22 +61,23 @@ func List(searchPath string) {
 				logErr("directory did not exist", "path", path)
 				return nil
 			}
-			if !info.IsDir() && strings.HasSuffix(path, ".jsonld") {
+			if !info.IsDir() && isModelFile(path) {
 				if e1 != nil {
 					return e1
 				}
-				var data any
 				content, err := os.ReadFile(path)
 				if err != nil {
 					return err
 				}
 
-				if err := json.Unmarshal(content, &data); err != nil {
-					slog.Error("unable to read valid json from stdin", "error", err)
+				data, err := parseContent(content, path)
+				if err != nil {
+					slog.Error("unable to read model", "error", err)
 				}
 				//atType, _ := jsonpath.Get("$.type", data)
-				title, _ := jsonpath.Get("$.title", data)
-				fmt.Printf("%60s Title: '%s'\n", path, title)
+				title, _ := jsonpath.Get("$.title", plainValue(data))
+				titleText, _ := title.(string)
+				models = append(models, ModelInfo{Name: ModelName(path), Title: titleText, Path: path})
 			}
 
 			return nil
@@ -63,4 +86,21 @@ func List(searchPath string) {
 			slog.Error("unable to list models dir", "error", err)
 		}
 	}
+	return models
+}
+
+// FindModel returns the path of the first model of the search path with the given name
+func FindModel(searchPath string, name string) (string, bool) {
+	for _, m := range ListModels(searchPath) {
+		if m.Name == name {
+			return m.Path, true
+		}
+	}
+	return "", false
+}
+
+func List(searchPath string) {
+	for _, m := range ListModels(searchPath) {
+		fmt.Printf("%60s Title: '%s'\n", m.Path, m.Title)
+	}
 }
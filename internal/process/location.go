@@ -0,0 +1,194 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// loadedFiles records the absolute location of every document loaded
+// while processing a model. It is shared by all processors of a model.
+type loadedFiles struct {
+	locations []string
+	// models checked against the TM schema
+	validated []string
+}
+
+func (l *loadedFiles) add(location string) {
+	if !slices.Contains(l.locations, location) {
+		l.locations = append(l.locations, location)
+	}
+}
+
+// firstValidation reports if the model at location is not validated yet
+func (l *loadedFiles) firstValidation(location string) bool {
+	if slices.Contains(l.validated, location) {
+		return false
+	}
+	l.validated = append(l.validated, location)
+	return true
+}
+
+// LoadedFiles returns the absolute locations of all documents
+// loaded for the processed model, including extended, referenced
+// and submodels and the placeholder map.
+func (p *Processor) LoadedFiles() []string {
+	return slices.Clone(p.loaded.locations)
+}
+
+// HrefRestriction limits the documents, which models may load, e.g.
+// models posted to the server. Without the exceptions only relative
+// hrefs without ".." to files in the search path are allowed.
+type HrefRestriction struct {
+	// allow absolute paths, ".." and files outside of the search path
+	AllowFiles bool
+	// allow http and https URLs
+	AllowRemote bool
+}
+
+// SetHrefRestriction limits the documents loaded by the models, nil
+// removes the restriction
+func (p *Processor) SetHrefRestriction(r *HrefRestriction) {
+	p.hrefRestriction = r
+}
+
+// checkHref reports an error if the restriction of p does not allow
+// href, which was resolved to location
+func (p *Processor) checkHref(href string, location string) error {
+	r := p.hrefRestriction
+	switch {
+	case r == nil:
+		return nil
+	case isRemote(location):
+		if !r.AllowRemote {
+			return fmt.Errorf("%s: remote hrefs are not allowed", href)
+		}
+		return nil
+	case r.AllowFiles:
+		return nil
+	case filepath.IsAbs(href) || strings.HasPrefix(href, "file:") || slices.Contains(strings.Split(filepath.ToSlash(href), "/"), ".."):
+		return fmt.Errorf("%s: absolute hrefs and hrefs with '..' are not allowed", href)
+	case !p.inSearchPath(location):
+		return fmt.Errorf("%s: files outside of the search path are not allowed", href)
+	}
+	return nil
+}
+
+// inSearchPath reports if the file at location is in a directory of the
+// search path, symbolic links are resolved
+func (p *Processor) inSearchPath(location string) bool {
+	file, err := filepath.EvalSymlinks(location)
+	if err != nil {
+		return false
+	}
+	for _, dir := range p.inputPath {
+		if dir == "" {
+			dir = "."
+		}
+		dir, err := filepath.Abs(dir)
+		if err == nil {
+			dir, err = filepath.EvalSymlinks(dir)
+		}
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(dir, file); err == nil && filepath.IsLocal(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// referrer is the location of the document, which references the model
+// of this processor. Top level models have no referrer.
+func (p *Processor) referrer() string {
+	if p.extendedBy != nil {
+		return p.extendedBy.location
+	}
+	if p.parent != nil {
+		return p.parent.location
+	}
+	return ""
+}
+
+// resolveLocation determines the absolute location of href. Relative
+// hrefs are resolved against base, the location of the referencing
+// document. Bare file names not found next to base and hrefs without
+// base are searched in the input path.
+func (p *Processor) resolveLocation(href string, base string) (string, error) {
+	if isRemote(href) {
+		return href, nil
+	}
+	if strings.HasPrefix(href, "file:") {
+		u, err := url.Parse(href)
+		if err != nil {
+			return "", err
+		}
+		return filepath.FromSlash(u.Path), nil
+	}
+	if isRemote(base) {
+		baseURL, err := url.Parse(base)
+		if err != nil {
+			return "", err
+		}
+		ref, err := url.Parse(filepath.ToSlash(href))
+		if err != nil {
+			return "", err
+		}
+		return baseURL.ResolveReference(ref).String(), nil
+	}
+	if filepath.IsAbs(href) {
+		return href, nil
+	}
+	if base != "" {
+		candidate := filepath.Join(filepath.Dir(base), href)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+		if !isBareName(href) {
+			return "", fmt.Errorf("file %s not found relative to %s", href, base)
+		}
+	}
+	if len(p.inputPath) == 0 {
+		p.inputPath = append(p.inputPath, ".")
+	}
+	for _, dir := range p.inputPath {
+		testPath := filepath.Join(dir, href)
+		if _, err := os.Stat(testPath); os.IsNotExist(err) {
+			slog.Debug(fmt.Sprintf("File %s not found at path %s", href, dir))
+			continue
+		}
+		return filepath.Abs(testPath)
+	}
+	return "", fmt.Errorf("file %s not found", href)
+}
+
+func isBareName(href string) bool {
+	return !strings.ContainsAny(href, `/\`)
+}
+
+// baseName is the last element of a file path or URL
+func baseName(location string) string {
+	return path.Base(filepath.ToSlash(location))
+}
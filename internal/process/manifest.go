@@ -0,0 +1,277 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A manifest lists the TDs of a batch build, e.g. in yaml
+//
+//	entries:
+//	  - model: dim.jsonld
+//	    varmap: vars-kitchen.json
+//	    vars:
+//	      deviceId: kitchen-1
+//	    output: kitchen-1.td.jsonld
+//
+// Only model is required. The varmap replaces the placeholder map of
+// the build command, vars override single values. Relative models and
+// varmaps are resolved against the manifest, bare names are searched
+// in the search path, too.
+
+// ManifestEntry is a TD to build
+type ManifestEntry struct {
+	Model  string
+	VarMap string
+	Vars   *Object
+	// name of the written TD, default is the name of the model
+	Output string
+}
+
+func (e ManifestEntry) String() string {
+	if e.Output == "" {
+		return e.Model
+	}
+	return e.Model + " -> " + e.Output
+}
+
+// Manifest is the list of TDs of a batch build
+type Manifest struct {
+	// absolute location of the manifest file
+	location string
+	Entries  []ManifestEntry
+}
+
+var manifestEntryKeys = []string{"model", "varmap", "vars", "output"}
+
+// LoadManifest reads a json or yaml manifest
+func LoadManifest(filename string) (*Manifest, error) {
+	location, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(location)
+	if err != nil {
+		return nil, err
+	}
+	data, err := parseContent(content, location)
+	if err != nil {
+		return nil, err
+	}
+	obj, _ := data.(*Object)
+	entries, ok := obj.Value("entries").([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: entries is missing or not a list", filename)
+	}
+	m := &Manifest{location: location}
+	var errs []error
+	for i, e := range entries {
+		entry, err := parseManifestEntry(e)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: entry %d: %w", filename, i+1, err))
+			continue
+		}
+		m.Entries = append(m.Entries, entry)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func parseManifestEntry(e any) (ManifestEntry, error) {
+	var entry ManifestEntry
+	obj, ok := e.(*Object)
+	if !ok {
+		return entry, fmt.Errorf("not an object")
+	}
+	for _, key := range obj.Keys() {
+		if !slices.Contains(manifestEntryKeys, key) {
+			return entry, fmt.Errorf("unknown member %s", key)
+		}
+	}
+	members := map[string]*string{"model": &entry.Model, "varmap": &entry.VarMap, "output": &entry.Output}
+	for key, dest := range members {
+		v, found := obj.Get(key)
+		if !found {
+			continue
+		}
+		if *dest, ok = v.(string); !ok {
+			return entry, fmt.Errorf("%s is not a string", key)
+		}
+	}
+	if entry.Model == "" {
+		return entry, fmt.Errorf("model is missing")
+	}
+	if vars, found := obj.Get("vars"); found {
+		if entry.Vars, ok = vars.(*Object); !ok {
+			return entry, fmt.Errorf("vars is not an object")
+		}
+	}
+	return entry, nil
+}
+
+// checkOutputs rejects entries, which would overwrite the TD of another
+// entry. The file names are derived like the processors of the entries
+// do, e.g. dim.jsonld, ./dim.jsonld and a/dim.jsonld all write dim.jsonld.
+func (p *Processor) checkOutputs(m *Manifest) error {
+	outputs := make(map[string]int)
+	for i, e := range m.Entries {
+		ep := p.withSettings()
+		ep.filename, ep.output = e.Model, e.Output
+		name := filepath.Clean(ep.outputName())
+		if first, found := outputs[name]; found {
+			return fmt.Errorf("entries %d and %d write %s, set the output of the entries", first+1, i+1, name)
+		}
+		outputs[name] = i
+	}
+	return nil
+}
+
+// BatchResult is the outcome of building a manifest entry
+type BatchResult struct {
+	Entry ManifestEntry
+	// name of the written TD
+	Output string
+	// the TD and its encoded form
+	TD      *Object
+	Content []byte
+	// all written TDs by file name, including the TDs of linked submodels
+	TDs map[string]*Object
+	// locations of the files loaded for the TD
+	Files    []string
+	Err      error
+	Duration time.Duration
+}
+
+// WriteBatchReport writes the result of every entry of a batch build
+// and returns the number of failed entries
+func WriteBatchReport(w io.Writer, results []BatchResult) int {
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+			fmt.Fprintf(w, "FAIL %s: %s\n", r.Entry, strings.ReplaceAll(r.Err.Error(), "\n", "\n\t"))
+			continue
+		}
+		fmt.Fprintf(w, "ok   %s -> %s (%s)\n", r.Entry.Model, r.Output, r.Duration.Round(time.Millisecond))
+	}
+	fmt.Fprintf(w, "%d built, %d failed\n", len(results)-failed, failed)
+	return failed
+}
+
+// BuildManifest builds, validates and saves the TDs of all entries of
+// the manifest with the settings of p. The entries are processed
+// concurrently by workers, the results are in the order of the entries.
+// Nothing is built if two entries would write the same TD.
+func (p *Processor) BuildManifest(m *Manifest, workers int, validate bool) ([]BatchResult, error) {
+	if err := p.checkOutputs(m); err != nil {
+		return nil, err
+	}
+	results := make([]BatchResult, len(m.Entries))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < max(workers, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = p.buildEntry(m, m.Entries[i], validate)
+			}
+		}()
+	}
+	for i := range m.Entries {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results, nil
+}
+
+func (p *Processor) buildEntry(m *Manifest, e ManifestEntry, validate bool) BatchResult {
+	start := time.Now()
+	res := BatchResult{Entry: e}
+	ep := p.newBatchProcessor()
+	ep.output = e.Output
+	ep.validateModels = validate
+	res.Err = func() error {
+		if e.VarMap != "" {
+			varMap, _, err := ep.loadFile(e.VarMap, m.location)
+			if err != nil {
+				return err
+			}
+			vars, ok := varMap.(*Object)
+			if !ok {
+				return fmt.Errorf("varmap %s is not a map of values", e.VarMap)
+			}
+			ep.VarMap = vars
+		}
+		ep.AddPlaceholders(e.Vars)
+		model, err := ep.resolveLocation(e.Model, m.location)
+		if err != nil {
+			return err
+		}
+		if err := ep.processAt(e.Model, model); err != nil {
+			return err
+		}
+		res.Output = ep.outputName()
+		if validate {
+			if err := ep.Validate(); err != nil {
+				return err
+			}
+		}
+		content, err := ep.Encode()
+		if err != nil {
+			return fmt.Errorf("encode %s: %w", res.Output, err)
+		}
+		res.Content, res.TD, res.TDs = content, ep.data.(*Object), ep.writtenTDs()
+		return ep.save(content)
+	}()
+	res.Files = ep.LoadedFiles()
+	res.Duration = time.Since(start)
+	return res
+}
+
+// writtenTDs returns the TD of p and in link mode the TDs of all
+// submodels by their file names
+func (p *Processor) writtenTDs() map[string]*Object {
+	tds := map[string]*Object{p.outputName(): p.data.(*Object)}
+	if p.submodelMode == SubmodelLink {
+		for _, item := range p.items {
+			maps.Copy(tds, item.writtenTDs())
+		}
+	}
+	return tds
+}
+
+// newBatchProcessor creates a processor for a manifest entry with
+// the settings of p
+func (p *Processor) newBatchProcessor() *Processor {
+	np := p.withSettings()
+	np.loaded, np.drop = &loadedFiles{}, p.drop
+	return np
+}
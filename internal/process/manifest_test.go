@@ -0,0 +1,51 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"testing"
+)
+
+func TestCheckOutputs(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []ManifestEntry
+		format  string
+		ok      bool
+	}{
+		{"different models", []ManifestEntry{{Model: "dim.jsonld"}, {Model: "onoff.jsonld"}}, FormatJSON, true},
+		{"same model", []ManifestEntry{{Model: "dim.jsonld"}, {Model: "dim.jsonld"}}, FormatJSON, false},
+		{"relative path", []ManifestEntry{{Model: "dim.jsonld"}, {Model: "./dim.jsonld"}}, FormatJSON, false},
+		{"other directory", []ManifestEntry{{Model: "a/dim.jsonld"}, {Model: "b/dim.jsonld"}}, FormatJSON, false},
+		{"output of a model", []ManifestEntry{{Model: "dim.jsonld"}, {Model: "onoff.jsonld", Output: "dim.jsonld"}}, FormatJSON, false},
+		{"output in other format", []ManifestEntry{{Model: "dim.jsonld"}, {Model: "onoff.jsonld", Output: "dim.jsonld"}}, FormatYAML, true},
+		{"tm model", []ManifestEntry{{Model: "lamp.tm.jsonld"}, {Model: "x.jsonld", Output: "./lamp.td.jsonld"}}, FormatJSON, false},
+		{"explicit outputs", []ManifestEntry{{Model: "dim.jsonld", Output: "a.td.jsonld"}, {Model: "dim.jsonld", Output: "b.td.jsonld"}}, FormatJSON, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProcessor("", "")
+			if err := p.SetFormat(tt.format); err != nil {
+				t.Fatal(err)
+			}
+			err := p.checkOutputs(&Manifest{Entries: tt.entries})
+			if (err == nil) != tt.ok {
+				t.Errorf("got error %v, want ok %t", err, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,292 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// A register map is a CSV file with a header row and the columns
+//
+//	property  name of the property in the TD, or instance/affordance
+//	address   register or coil address, decimal or hex like 0x10
+//	type      bool, int16, uint16, int32, uint32, int64, uint64, float32, float64 or string
+//	length    number of registers or coils, default is the size of the type
+//	function  Modbus function code 1-6, 15 or 16
+//	scaling   factor of the raw value, default 1
+//
+// Columns are matched by name, length and scaling may be omitted.
+// Lines starting with # are comments.
+
+// registerType describes the values a Modbus data type can hold
+type registerType struct {
+	// number of 16 bit registers, 0 if it is given by the length
+	registers int
+	xsdType   string
+	jsonType  string
+	min       float64
+	max       float64
+}
+
+var registerTypes = map[string]registerType{
+	"bool":    {1, "xsd:boolean", "boolean", 0, 1},
+	"int16":   {1, "xsd:short", "integer", math.MinInt16, math.MaxInt16},
+	"uint16":  {1, "xsd:unsignedShort", "integer", 0, math.MaxUint16},
+	"int32":   {2, "xsd:int", "integer", math.MinInt32, math.MaxInt32},
+	"uint32":  {2, "xsd:unsignedInt", "integer", 0, math.MaxUint32},
+	"int64":   {4, "xsd:long", "integer", math.MinInt64, math.MaxInt64},
+	"uint64":  {4, "xsd:unsignedLong", "integer", 0, math.MaxUint64},
+	"float32": {2, "xsd:float", "number", -math.MaxFloat32, math.MaxFloat32},
+	"float64": {4, "xsd:double", "number", -math.MaxFloat64, math.MaxFloat64},
+	"string":  {0, "xsd:string", "string", 0, 0},
+}
+
+// modbusEntity is the data model of a function code with its read and write functions
+type modbusEntity struct {
+	name     string
+	read     string
+	write    string
+	writeMul string
+	bits     bool
+}
+
+var (
+	modbusCoil            = modbusEntity{"Coil", "readCoil", "writeSingleCoil", "writeMultipleCoils", true}
+	modbusDiscreteInput   = modbusEntity{"DiscreteInput", "readDeviceDiscreteInput", "", "", true}
+	modbusHoldingRegister = modbusEntity{"HoldingRegister", "readHoldingRegisters", "writeSingleHoldingRegister", "writeMultipleHoldingRegisters", false}
+	modbusInputRegister   = modbusEntity{"InputRegister", "readInputRegisters", "", "", false}
+)
+
+var modbusFunctionCodes = map[int]modbusEntity{
+	1:  modbusCoil,
+	2:  modbusDiscreteInput,
+	3:  modbusHoldingRegister,
+	4:  modbusInputRegister,
+	5:  modbusCoil,
+	6:  modbusHoldingRegister,
+	15: modbusCoil,
+	16: modbusHoldingRegister,
+}
+
+// modbusRegister is a row of a register map
+type modbusRegister struct {
+	// file and line for messages
+	source   string
+	address  uint64
+	typeName string
+	typ      registerType
+	length   int
+	entity   modbusEntity
+	scaling  float64
+}
+
+var registerColumns = []string{"property", "address", "type", "length", "function", "scaling"}
+
+// parseRegisterMap reads a register map, the result is keyed by the property column
+func parseRegisterMap(content []byte, location string) (map[string]*modbusRegister, error) {
+	r := csv.NewReader(bytes.NewReader(content))
+	r.Comment = '#'
+	r.TrimLeadingSpace = true
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", location, err)
+	}
+	columns := make(map[string]int)
+	for i, h := range header {
+		columns[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	for _, c := range []string{"property", "address", "type", "function"} {
+		if _, found := columns[c]; !found {
+			return nil, fmt.Errorf("%s: missing column %s, the columns are %s", location, c, strings.Join(registerColumns, ", "))
+		}
+	}
+	registers := make(map[string]*modbusRegister)
+	var errs []error
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", location, err)
+		}
+		line, _ := r.FieldPos(0)
+		field := func(name string) string {
+			if i, found := columns[name]; found && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		reg, err := newModbusRegister(field)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s:%d: %w", location, line, err))
+			continue
+		}
+		reg.source = fmt.Sprintf("%s:%d", location, line)
+		name := field("property")
+		if _, found := registers[name]; found {
+			errs = append(errs, fmt.Errorf("%s: property %s is mapped twice", reg.source, name))
+			continue
+		}
+		registers[name] = reg
+	}
+	return registers, errors.Join(errs...)
+}
+
+func newModbusRegister(field func(string) string) (*modbusRegister, error) {
+	reg := &modbusRegister{typeName: strings.ToLower(field("type")), scaling: 1}
+	if field("property") == "" {
+		return nil, fmt.Errorf("property is empty")
+	}
+	var ok bool
+	if reg.typ, ok = registerTypes[reg.typeName]; !ok {
+		return nil, fmt.Errorf("unknown register type '%s'", field("type"))
+	}
+	var err error
+	if reg.address, err = strconv.ParseUint(field("address"), 0, 16); err != nil {
+		return nil, fmt.Errorf("invalid address '%s'", field("address"))
+	}
+	code, err := strconv.Atoi(field("function"))
+	if reg.entity, ok = modbusFunctionCodes[code]; err != nil || !ok {
+		return nil, fmt.Errorf("unsupported function code '%s'", field("function"))
+	}
+	reg.length = reg.typ.registers
+	if s := field("length"); s != "" {
+		if reg.length, err = strconv.Atoi(s); err != nil || reg.length < 1 {
+			return nil, fmt.Errorf("invalid length '%s'", s)
+		}
+	}
+	switch {
+	case reg.entity.bits && reg.typeName != "bool":
+		return nil, fmt.Errorf("a %s holds bool values, not %s", reg.entity.name, reg.typeName)
+	case reg.typeName == "string" && reg.length == 0:
+		return nil, fmt.Errorf("the length of a string is required")
+	case reg.length < reg.typ.registers:
+		return nil, fmt.Errorf("%s needs %d registers, length is %d", reg.typeName, reg.typ.registers, reg.length)
+	}
+	if s := field("scaling"); s != "" {
+		if reg.scaling, err = strconv.ParseFloat(s, 64); err != nil || reg.scaling <= 0 {
+			return nil, fmt.Errorf("invalid scaling '%s'", s)
+		}
+	}
+	return reg, nil
+}
+
+// check validates that the values of a property fit into the register
+func (reg *modbusRegister) check(property *Object) error {
+	typ, _ := property.Value("type").(string)
+	var errs []error
+	scaledInteger := reg.typ.jsonType == "integer" && reg.scaling == math.Trunc(reg.scaling)
+	switch {
+	case typ == reg.typ.jsonType && (typ != "integer" || scaledInteger):
+	case typ == "number" && reg.typ.jsonType == "integer":
+	default:
+		valueType := reg.typ.jsonType
+		if !scaledInteger && valueType == "integer" {
+			valueType = "number"
+		}
+		errs = append(errs, fmt.Errorf("type %s doesn't fit %s values of register type %s", typ, valueType, reg.typeName))
+	}
+	if reg.typ.jsonType == "integer" || reg.typ.jsonType == "number" {
+		low, high := reg.typ.min*reg.scaling, reg.typ.max*reg.scaling
+		for _, key := range []string{"minimum", "exclusiveMinimum", "maximum", "exclusiveMaximum"} {
+			n, ok := property.Value(key).(json.Number)
+			if !ok {
+				continue
+			}
+			v, err := n.Float64()
+			if err != nil || v < low || v > high {
+				errs = append(errs, fmt.Errorf("%s %s is outside of the range [%g, %g] of register type %s", key, n, low, high, reg.typeName))
+			}
+		}
+	}
+	if maxLength, ok := property.Value("maxLength").(json.Number); ok && reg.typeName == "string" {
+		if l, err := maxLength.Int64(); err != nil || l > int64(2*reg.length) {
+			errs = append(errs, fmt.Errorf("maxLength %s exceeds the %d bytes of %d registers", maxLength, 2*reg.length, reg.length))
+		}
+	}
+	if !reg.writable() && !isReadOnly(property) {
+		errs = append(errs, fmt.Errorf("the %s is read only, but the property is not readOnly", reg.entity.name))
+	}
+	return errors.Join(errs...)
+}
+
+func isReadOnly(property *Object) bool {
+	readOnly, _ := property.Value("readOnly").(bool)
+	return readOnly
+}
+
+func (reg *modbusRegister) writable() bool {
+	return reg.entity.write != ""
+}
+
+// templates returns the form templates of the register
+func (reg *modbusRegister) templates() map[string]*Object {
+	template := func(function string) *Object {
+		t := formTemplate("modv:entity", reg.entity.name, "modv:function", function, "modv:type", reg.typ.xsdType)
+		if reg.scaling != 1 {
+			t.Set("modv:scale", json.Number(strconv.FormatFloat(reg.scaling, 'g', -1, 64)))
+		}
+		return t
+	}
+	templates := map[string]*Object{"readproperty": template(reg.entity.read)}
+	switch {
+	case !reg.writable():
+	case reg.length == 1:
+		templates["writeproperty"] = template(reg.entity.write)
+	default:
+		templates["writeproperty"] = template(reg.entity.writeMul)
+	}
+	return templates
+}
+
+// registerFor finds the register of a property by its name in the TD
+// or by instance/affordance
+func (b *Binding) registerFor(vars *Object) (*modbusRegister, bool) {
+	candidates := []string{vars.Value("name").(string)}
+	if instance, ok := vars.Value("instance").(string); ok {
+		candidates = append(candidates, instance+"/"+vars.Value("affordance").(string))
+	}
+	for _, c := range candidates {
+		if reg, found := b.registers[c]; found {
+			return reg, true
+		}
+	}
+	return nil, false
+}
+
+// registerForms returns the forms of a property mapped to a register
+func (b *Binding) registerForms(property *Object, reg *modbusRegister, vars *Object) ([]any, error) {
+	if err := reg.check(property); err != nil {
+		return nil, fmt.Errorf("register map %s: %w", reg.source, err)
+	}
+	rb := *b
+	rb.Operations = reg.templates()
+	local := NewObject()
+	local.Set("address", json.Number(strconv.FormatUint(reg.address, 10)))
+	local.Set("quantity", json.Number(strconv.Itoa(reg.length)))
+	return rb.forms(property, []string{"readproperty", "writeproperty"}, overlayVars(vars, local))
+}
@@ -0,0 +1,118 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// The MQTT binding writes the topic as href relative to the broker,
+// which is the base of the TD. The default topic template is
+// {{deviceId}}/{{instance}}/{{affordance}}, empty topic levels of
+// unset variables are removed.
+const (
+	mqttDefaultTopic  = "{{deviceId|}}/{{instance|}}/{{affordance}}"
+	mqttDefaultBroker = "{{broker}}"
+	mqttDefaultScheme = "mqtt://"
+)
+
+// mqttOperations may be published or subscribed with a retain flag and QoS
+var mqttOperations = []string{"readproperty", "writeproperty", "observeproperty", "unobserveproperty",
+	"invokeaction", "subscribeevent", "unsubscribeevent"}
+
+// parseMQTT reads the MQTT members of a binding template: topic is an
+// alias of href, retain and qos are set for all operations or per
+// operation, e.g. "qos": {"writeproperty": 1, "subscribeevent": 2}.
+func parseMQTT(obj *Object, b *Binding) error {
+	if topic, found := obj.Get("topic"); found {
+		s, isString := topic.(string)
+		if !isString {
+			return fmt.Errorf("binding template: topic is not a string")
+		}
+		b.Href = s
+	}
+	if retain, found := obj.Get("retain"); found {
+		err := setPerOperation(b, "mqv:retain", retain, func(v any) (any, bool) {
+			r, isBool := v.(bool)
+			return r, isBool
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if qos, found := obj.Get("qos"); found {
+		err := setPerOperation(b, "mqv:qos", qos, func(v any) (any, bool) {
+			// the vocabulary defines the QoS levels as strings
+			var level string
+			switch q := v.(type) {
+			case json.Number:
+				level = q.String()
+			case string:
+				level = q
+			}
+			return level, slices.Contains([]string{"0", "1", "2"}, level)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setPerOperation sets a member of the form templates to a single
+// value or to the values of a map of operations
+func setPerOperation(b *Binding, member string, value any, convert func(any) (any, bool)) error {
+	perOp, isMap := value.(*Object)
+	if !isMap {
+		perOp = NewObject()
+		for _, op := range mqttOperations {
+			perOp.Set(op, value)
+		}
+	}
+	for _, op := range perOp.Keys() {
+		v, ok := convert(perOp.Value(op))
+		if !ok {
+			return fmt.Errorf("binding template: invalid %s %v of %s", member, perOp.Value(op), op)
+		}
+		if template, found := b.Operations[op]; found {
+			template = template.Clone()
+			template.Set(member, v)
+			b.Operations[op] = template
+		}
+	}
+	return nil
+}
+
+// mqttTopic removes empty topic levels of a relative href
+func mqttTopic(topic string) string {
+	if strings.Contains(topic, "://") {
+		return topic
+	}
+	levels := slices.DeleteFunc(strings.Split(topic, "/"), func(l string) bool { return l == "" })
+	return strings.Join(levels, "/")
+}
+
+// mqttBroker adds the mqtt scheme to a broker address like host:1883
+func mqttBroker(broker string) string {
+	if broker == "" || strings.Contains(broker, "://") {
+		return broker
+	}
+	return mqttDefaultScheme + broker
+}
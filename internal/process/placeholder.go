@@ -0,0 +1,313 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A placeholder has the form {{name}}, {{name:type}} or {{name:type|default}}.
+// The name may address nested values of the map, e.g. {{device.address}}.
+const placeholderBody = `\s*([\w-]+(?:\.[\w-]+)*)\s*(?::\s*(\w+)\s*)?`
+
+// doubleCurlyPattern finds placeholders embedded in a string
+var doubleCurlyPattern = regexp.MustCompile(`\{\{` + placeholderBody + `(?:\|(.*?))?\s*\}\}`)
+
+// wholeValuePattern matches a string consisting of exactly one placeholder.
+// Its default may contain braces, e.g. {{limits|{"max": 10}}}
+var wholeValuePattern = regexp.MustCompile(`^\s*\{\{` + placeholderBody + `(?:\|(.*?))?\s*\}\}\s*$`)
+
+// UnresolvedPlaceholder is a placeholder without value and default.
+type UnresolvedPlaceholder struct {
+	Path        string
+	Placeholder string
+}
+
+// PlaceholderError lists all unresolved placeholders of a model.
+type PlaceholderError struct {
+	Unresolved []UnresolvedPlaceholder
+}
+
+func (e *PlaceholderError) Error() string {
+	var b strings.Builder
+	b.WriteString("unresolved placeholders:")
+	for _, u := range e.Unresolved {
+		fmt.Fprintf(&b, "\n\t%s at %s", u.Placeholder, u.Path)
+	}
+	return b.String()
+}
+
+// placeholder is a parsed occurrence of a placeholder
+type placeholder struct {
+	text       string
+	name       string
+	typ        string
+	defaultVal string
+	hasDefault bool
+}
+
+func newPlaceholder(match []string, indexes []int) placeholder {
+	return placeholder{
+		text:       match[0],
+		name:       match[1],
+		typ:        match[2],
+		defaultVal: strings.TrimSpace(match[3]),
+		hasDefault: indexes[6] >= 0,
+	}
+}
+
+// substitution replaces placeholders in a document by values of vars
+type substitution struct {
+	vars       *Object
+	unresolved []UnresolvedPlaceholder
+}
+
+// substitute replaces all placeholders in the data of the processor.
+func (p *Processor) substitute() error {
+	s := &substitution{vars: p.VarMap}
+	var err error
+	p.data, err = s.value(p.data, &PathObject{})
+	if err != nil {
+		return fmt.Errorf("%s: %w", p.filename, err)
+	}
+	if len(s.unresolved) > 0 {
+		return fmt.Errorf("%s: %w", p.filename, &PlaceholderError{Unresolved: s.unresolved})
+	}
+	return nil
+}
+
+func (s *substitution) value(data any, po *PathObject) (any, error) {
+	switch d := data.(type) {
+	case *Object:
+		res := NewObject()
+		for _, key := range d.Keys() {
+			po.AddMap(key)
+			newKey, err := s.text(key, po)
+			if err != nil {
+				return nil, err
+			}
+			if res.Has(newKey) {
+				return nil, fmt.Errorf("%s: substituted key '%s' is not unique", po.String(), newKey)
+			}
+			v, err := s.value(d.Value(key), po)
+			if err != nil {
+				return nil, err
+			}
+			res.Set(newKey, v)
+			po.Up()
+		}
+		return res, nil
+	case []any:
+		for i, element := range d {
+			po.AddArray(i)
+			v, err := s.value(element, po)
+			if err != nil {
+				return nil, err
+			}
+			d[i] = v
+			po.Up()
+		}
+		return d, nil
+	case string:
+		// a default containing {{ belongs to a string of several placeholders
+		if m := wholeValuePattern.FindStringSubmatchIndex(d); m != nil && !strings.Contains(d[max(m[6], 0):max(m[7], 0)], "{{") {
+			ph := newPlaceholder(wholeValuePattern.FindStringSubmatch(d), m)
+			v, found, err := s.resolve(ph)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", po.String(), err)
+			}
+			if !found {
+				s.unresolved = append(s.unresolved, UnresolvedPlaceholder{Path: po.String(), Placeholder: ph.text})
+				return d, nil
+			}
+			// the value may be inserted several times
+			return deepCopy(v), nil
+		}
+		return s.text(d, po)
+	default:
+		return d, nil
+	}
+}
+
+// text replaces placeholders embedded in a string by the textual
+// representation of their values.
+func (s *substitution) text(str string, po *PathObject) (string, error) {
+	if !strings.Contains(str, "{{") {
+		return str, nil
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range doubleCurlyPattern.FindAllStringSubmatchIndex(str, -1) {
+		b.WriteString(str[last:m[0]])
+		last = m[1]
+		match := make([]string, 4)
+		for i := range match {
+			if m[2*i] >= 0 {
+				match[i] = str[m[2*i]:m[2*i+1]]
+			}
+		}
+		ph := newPlaceholder(match, m)
+		v, found, err := s.resolve(ph)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", po.String(), err)
+		}
+		if !found {
+			s.unresolved = append(s.unresolved, UnresolvedPlaceholder{Path: po.String(), Placeholder: ph.text})
+			b.WriteString(ph.text)
+			continue
+		}
+		b.WriteString(valueText(v))
+	}
+	b.WriteString(str[last:])
+	return b.String(), nil
+}
+
+// resolve looks up the value of a placeholder, falls back to its
+// default and converts it to the declared type.
+func (s *substitution) resolve(ph placeholder) (any, bool, error) {
+	v, found := lookupVar(s.vars, ph.name)
+	if !found {
+		if !ph.hasDefault {
+			return nil, false, nil
+		}
+		v = ph.defaultVal
+		if ph.typ == "" {
+			if parsed, err := decodeJSON([]byte(ph.defaultVal)); err == nil {
+				v = parsed
+			}
+		}
+	}
+	if ph.typ == "" {
+		return v, true, nil
+	}
+	v, err := coerce(v, ph.typ)
+	if err != nil {
+		return nil, true, fmt.Errorf("placeholder %s: %w", ph.text, err)
+	}
+	return v, true, nil
+}
+
+// lookupVar finds a value by name. Dots in a name address values of
+// nested maps, unless the name itself is a key of the map.
+func lookupVar(vars *Object, name string) (any, bool) {
+	if v, ok := vars.Get(name); ok {
+		return v, true
+	}
+	var current any = vars
+	for _, part := range strings.Split(name, ".") {
+		m, ok := current.(*Object)
+		if !ok {
+			return nil, false
+		}
+		current, ok = m.Get(part)
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// coerce converts a value to the json type declared by a placeholder.
+func coerce(v any, typ string) (any, error) {
+	str, isString := v.(string)
+	switch typ {
+	case "string":
+		return valueText(v), nil
+	case "number":
+		if isString {
+			return parseNumber(str, false)
+		}
+		if n, ok := v.(json.Number); ok {
+			return parseNumber(n.String(), false)
+		}
+	case "integer":
+		if isString {
+			return parseNumber(str, true)
+		}
+		if n, ok := v.(json.Number); ok {
+			return parseNumber(n.String(), true)
+		}
+	case "boolean":
+		if isString {
+			return strconv.ParseBool(strings.TrimSpace(str))
+		}
+		if _, ok := v.(bool); ok {
+			return v, nil
+		}
+	case "object", "array":
+		if isString {
+			parsed, err := decodeJSON([]byte(str))
+			if err != nil {
+				return nil, err
+			}
+			v = parsed
+		}
+		if _, ok := v.(*Object); ok && typ == "object" {
+			return v, nil
+		}
+		if _, ok := v.([]any); ok && typ == "array" {
+			return v, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown type '%s'", typ)
+	}
+	return nil, fmt.Errorf("value '%s' is not of type %s", valueText(v), typ)
+}
+
+var jsonIntegerPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)$`)
+
+// parseNumber checks the text of a number and keeps it as json.Number,
+// so large integers don't lose their precision. Only the number grammar
+// of JSON is accepted, strconv would also accept e.g. +5, NaN, Inf,
+// 0x1p3 and 1_000.
+func parseNumber(str string, integer bool) (json.Number, error) {
+	str = strings.TrimSpace(str)
+	if !jsonNumberPattern.MatchString(str) {
+		return "", fmt.Errorf("'%s' is not a json number", str)
+	}
+	if integer && jsonIntegerPattern.MatchString(str) {
+		return json.Number(str), nil
+	}
+	f, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return "", err
+	}
+	if integer {
+		if f != math.Trunc(f) {
+			return "", fmt.Errorf("%s is not an integer", str)
+		}
+		return json.Number(strconv.FormatFloat(f, 'f', -1, 64)), nil
+	}
+	return json.Number(str), nil
+}
+
+// valueText is the representation of a value embedded into a string
+func valueText(v any) string {
+	if str, ok := v.(string); ok {
+		return str
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
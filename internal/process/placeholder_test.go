@@ -0,0 +1,68 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		text    string
+		integer bool
+		want    json.Number
+		ok      bool
+	}{
+		{"5", false, "5", true},
+		{" -0.5e3 ", false, "-0.5e3", true},
+		{"9007199254740993", true, "9007199254740993", true},
+		{"1e3", true, "1000", true},
+		{"1.5", true, "", false},
+		{"+5", false, "", false},
+		{"NaN", false, "", false},
+		{"Inf", false, "", false},
+		{"0x1p3", false, "", false},
+		{"1_000", false, "", false},
+		{"05", false, "", false},
+		{".5", false, "", false},
+	}
+	for _, tt := range tests {
+		got, err := parseNumber(tt.text, tt.integer)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseNumber(%q, %t) = %q, %v, want %q", tt.text, tt.integer, got, err, tt.want)
+		}
+	}
+}
+
+func TestSubstituteInvalidNumber(t *testing.T) {
+	p := NewProcessor("", "")
+	p.filename = "lamp.tm.jsonld"
+	p.data, _ = decodeJSON([]byte(`{"properties": {"dim": {"maximum": "{{max:number}}"}}}`))
+	vars, _ := decodeJSON([]byte(`{"max": "NaN"}`))
+	p.VarMap = vars.(*Object)
+	err := p.substitute()
+	if err == nil {
+		t.Fatal("NaN is accepted as number")
+	}
+	for _, s := range []string{"{{max:number}}", "properties/dim/maximum", "lamp.tm.jsonld"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("error %q does not contain %s", err, s)
+		}
+	}
+}
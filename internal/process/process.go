@@ -17,17 +17,15 @@ limitations under the License.
 package process
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
-	"regexp"
+	"reflect"
+	"slices"
 	"strings"
 
 	"log/slog"
-
-	"github.com/PaesslerAG/jsonpath"
 )
 
 // used for debug output in this file
@@ -43,57 +41,152 @@ type Link struct {
 type Extension struct {
 	extentLevel int
 	data        any
+	required    []Requirement
+	optional    []string
+	origins     map[string]string
 }
 
-func (p *Processor) loadFile(filename string) (data any, err error) {
+// loadFile reads the document referenced by href, relative hrefs are
+// resolved against base. It returns the content and the absolute location.
+func (p *Processor) loadFile(href string, base string) (data any, location string, err error) {
+	content, location, err := p.readFile(href, base)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err = parseContent(content, location)
+	return data, location, err
+}
 
-	if len(p.inputPath) == 0 {
-		p.inputPath = append(p.inputPath, ".")
+// readFile returns the unparsed content of the file referenced by href
+// and its absolute location.
+func (p *Processor) readFile(href string, base string) (content []byte, location string, err error) {
+	location, err = p.resolveLocation(href, base)
+	if err != nil {
+		return nil, "", err
 	}
-	for _, path := range p.inputPath {
-		testPath := filepath.Join(path, filename)
-		if _, err := os.Stat(testPath); os.IsNotExist(err) {
-			slog.Error(fmt.Sprintf("File %s not found at path %s\n", filename, path))
-			continue
-		}
-		content, err := os.ReadFile(testPath)
-		if err != nil {
-			return nil, err
+	if err = p.checkHref(href, location); err != nil {
+		return nil, "", err
+	}
+	if isRemote(location) {
+		content, err = p.resolver.Fetch(location)
+	} else {
+		location, err = filepath.Abs(location)
+		if err == nil {
+			content, err = os.ReadFile(location)
 		}
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	slog.Info("load file", "href", href, "location", location)
+	p.loaded.add(location)
+	return content, location, nil
+}
 
-		if err := json.Unmarshal(content, &data); err != nil {
-			slog.Error(fmt.Sprintf("unable to read valid json from %s", testPath), "error", err)
+// ParseDocument reads a JSON document, or a YAML document if the
+// extension of name is .yaml or .yml
+func ParseDocument(content []byte, name string) (any, error) {
+	return parseContent(content, name)
+}
+
+func parseContent(content []byte, location string) (data any, err error) {
+	if isYAML(location) {
+		data, err = decodeYAML(content)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read valid yaml from %s: %w", location, err)
 		}
-		slog.Info("load file", "path", filename)
 		return data, nil
 	}
-	return nil, fmt.Errorf("file %s not found", filename)
+	data, err = decodeJSON(content)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read valid json from %s: %w", location, err)
+	}
+	return data, nil
 }
 
-var doubleCurlyPattern = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
-
 // Process is the main entry point to build a thing description
 // out of a thing model, based on the parameters in Processor struct
 // but also to process submodel in a top level TM.
 func (p *Processor) Process(filename string) error {
+	data, location, err := p.loadFile(filename, p.referrer())
+	if err != nil {
+		return err
+	}
+	return p.process(filename, data, location)
+}
+
+// processAt builds a thing description out of the model at the resolved
+// location, filename names the model in the type link of the TD
+func (p *Processor) processAt(filename string, location string) error {
+	data, location, err := p.loadFile(location, "")
+	if err != nil {
+		return err
+	}
+	return p.process(filename, data, location)
+}
+
+// ProcessData builds a thing description out of a thing model, which
+// is already loaded. filename names the model in the output, its
+// relative references are searched in the input path.
+func (p *Processor) ProcessData(data any, filename string) error {
+	if _, ok := data.(*Object); !ok {
+		return fmt.Errorf("%s: the model is not a json object", filename)
+	}
+	return p.process(filename, data, "")
+}
+
+func (p *Processor) process(filename string, data any, location string) error {
 	if d {
 		slog.Debug("Start Process", "filename", filename, "instance", p.instance.String())
 	}
 	p.filename = filename
-	var err error
-	p.data, err = p.loadFile(filename)
+	p.data, p.location = data, location
+	source := location
+	if source == "" {
+		source = filename
+	}
+	if err := p.validateModel(source, data); err != nil {
+		return err
+	}
+	if p.graph != nil && location != "" {
+		p.graph.addModel(location, data)
+	}
+	err := p.pushLocation()
 	if err != nil {
 		return err
 	}
-	p.iterate(p.data, &PathObject{})
+	p.recordOrigins()
+	errIterate := p.iterate(p.data, &PathObject{})
 	p.extendAll()
+	err = errors.Join(errIterate, p.collectRequirements())
+	if p.extendedBy != nil {
+		// an extended model is merged by the extending processor
+		if d {
+			slog.Debug("End  Process", "filename", filename, "instance", p.instance.String(), "extendedBy", p.extendedBy.filename)
+		}
+		return err
+	}
+	err = errors.Join(err, p.substitute(), p.checkRequired())
+	if err != nil {
+		return err
+	}
+	if err = p.generateForms(); err != nil {
+		return err
+	}
 	//copy things to parent
-	if p.parent != nil {
+	if p.parent != nil && p.submodelMode != SubmodelLink {
 		p.copy(p.parent)
 	} else {
 		p.insertTypeLink()
-		thingMap := p.data.(map[string]any)
-		thingMap["@type"] = "Thing"
+		thingMap := p.data.(*Object)
+		thingMap.Set("@type", "Thing")
+		err = errors.Join(p.dropOptional(), p.setBase())
+		if err != nil {
+			return err
+		}
+		if p.parent == nil && p.submodelMode == SubmodelLink {
+			p.linkItems()
+		}
 	}
 	p.checkVersionInstance()
 	if d {
@@ -102,123 +195,366 @@ func (p *Processor) Process(filename string) error {
 	return nil
 }
 
+var copiedMapSections = []string{"properties", "actions", "events", "securityDefinitions"}
+
 func (p *Processor) copy(to *Processor) {
-	p.copyMapSection("properties", to)
-	p.copyMapSection("actions", to)
-	p.copyMapSection("events", to)
-	p.copyMapSection("securityDefinitions", to)
+	for _, section := range copiedMapSections {
+		p.copyMapSection(section, to)
+	}
+	p.copySecurity(to)
 	p.copyArraySection("links", to)
+	if ctx, found := p.data.(*Object).Get("@context"); found {
+		destMap := to.data.(*Object)
+		destMap.Set("@context", mergeContext(destMap.Value("@context"), ctx))
+	}
+	rename := func(ptr string) string {
+		return renamePointer(ptr, p.instancePrefix(), copiedMapSections)
+	}
+	for _, ptr := range p.optional {
+		to.optional = append(to.optional, rename(ptr))
+	}
+	to.inheritOrigins(p.origins, func(ptr string) string {
+		if renamed := rename(ptr); renamed != ptr {
+			return renamed
+		}
+		// top level members are not copied
+		return ""
+	})
+}
+
+// instancePrefix is prepended to the names of copied affordances
+func (p *Processor) instancePrefix() string {
+	prefix := p.instance.String()
+	if len(prefix) > 0 {
+		prefix = prefix + "_"
+	}
+	return prefix
 }
 
 // copyMapSection
 func (p *Processor) copyMapSection(section string, to *Processor) {
-	srcMap := p.data.(map[string]any)
-	srcSect, okSrcSect := srcMap[section]
+	srcMap := p.data.(*Object)
+	srcSect, okSrcSect := srcMap.Get(section)
 	if okSrcSect {
-		destMap := to.data.(map[string]any)
-		destSect, okDestSect := destMap[section]
+		destMap := to.data.(*Object)
+		destSect, okDestSect := destMap.Get(section)
 		if !okDestSect {
-			destMap[section] = make(map[string]any)
-			destSect = destMap[section]
+			destSect = NewObject()
+			destMap.Set(section, destSect)
 		}
-		destSectMap := destSect.(map[string]any)
-		srcSectMap := srcSect.(map[string]any)
-		prefix := p.instance.String()
-		if len(prefix) > 0 {
-			prefix = prefix + "_"
+		destSectMap := destSect.(*Object)
+		srcSectMap := srcSect.(*Object)
+		prefix := p.instancePrefix()
+		for _, k := range srcSectMap.Keys() {
+			destSectMap.Set(prefix+k, srcSectMap.Value(k))
 		}
-		for k, v := range srcSectMap {
-			destSectMap[prefix+k] = v
+	}
+}
+
+// copySecurity adds the prefixed names of the security schemes of p to
+// the security of to, the schemes are copied with securityDefinitions
+func (p *Processor) copySecurity(to *Processor) {
+	security, found := p.data.(*Object).Get("security")
+	if !found {
+		return
+	}
+	prefix := p.instancePrefix()
+	var names []any
+	for _, name := range asArray(security) {
+		if s, ok := name.(string); ok {
+			names = append(names, prefix+s)
 		}
 	}
+	destMap := to.data.(*Object)
+	destMap.Set("security", mergeArrayUnique(destMap.Value("security"), names))
 }
 
 func (p *Processor) copyArraySection(section string, to *Processor) {
-	srcMap := p.data.(map[string]any)
-	srcSect, okSrcSect := srcMap[section]
+	srcMap := p.data.(*Object)
+	srcSect, okSrcSect := srcMap.Get(section)
 	if okSrcSect {
-		destMap := to.data.(map[string]any)
-		destSect, okDestSect := destMap[section]
-		if !okDestSect {
-			destSect = make(map[string]any)
-		}
-		destSectArray := destSect.([]any)
+		destMap := to.data.(*Object)
+		destSectArray, _ := destMap.Value(section).([]any)
 		srcSectArray := srcSect.([]any)
-		destSectArray = append(destSectArray, srcSectArray)
-		destMap[section] = destSectArray
+		destSectArray = append(destSectArray, srcSectArray...)
+		destMap.Set(section, destSectArray)
+	}
+}
+
+// TD returns the TD of the already processed TM
+func (p *Processor) TD() *Object {
+	td, _ := p.data.(*Object)
+	return td
+}
+
+// Encode returns the serialized TD of the already processed TM
+func (p *Processor) Encode() ([]byte, error) {
+	data := p.data
+	ld := p.jsonLD()
+	ctx := p.data.(*Object).Value("@context")
+	switch p.format {
+	case FormatNTriples, FormatTurtle:
+		expanded, err := ld.Expand(p.data)
+		if err != nil {
+			return nil, err
+		}
+		if p.format == FormatNTriples {
+			return encodeNTriples(toTriples(expanded)), nil
+		}
+		prefixes, err := ld.prefixes(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return encodeTurtle(toTriples(expanded), prefixes), nil
+	}
+	if p.jsonld != "" {
+		expanded, err := ld.Expand(p.data)
+		if err != nil {
+			return nil, err
+		}
+		data = expanded
+		if p.jsonld == JSONLDCompact {
+			if data, err = ld.Compact(expanded, ctx); err != nil {
+				return nil, err
+			}
+		}
+	}
+	enc := NewEncoder(p.indent)
+	enc.SetKeepOrder(p.keepOrder)
+	switch p.format {
+	case FormatYAML:
+		return enc.EncodeYAML(data)
+	case FormatCBOR:
+		enc.SetKeyCompression(p.compressKeys)
+		return enc.EncodeCBOR(data)
 	}
+	return enc.Encode(data)
+}
+
+// ContentType returns the media type of the encoded TD
+func (p *Processor) ContentType() string {
+	switch p.format {
+	case FormatYAML:
+		return "application/yaml"
+	case FormatCBOR:
+		return "application/cbor"
+	case FormatNTriples:
+		return "application/n-triples"
+	case FormatTurtle:
+		return "text/turtle"
+	}
+	if p.jsonld != "" {
+		return "application/ld+json"
+	}
+	return "application/td+json"
+}
+
+// jsonLD returns a JSON-LD processor loading contexts, which are not
+// bundled, with the resolver of p
+func (p *Processor) jsonLD() *jsonLD {
+	return &jsonLD{load: func(url string) (any, error) {
+		data, _, err := p.loadFile(url, "")
+		return data, err
+	}}
 }
 
 // Save the serialized TD of the already processed TM to
-// the defined output
-func (p *Processor) Save() {
-	// print the result to Outputfile
-	prt := NewPrinter()
-	printAll(p.data, &PathObject{}, prt, p.VarMap)
+// the defined output. In link mode the TDs of all submodels
+// are saved, too.
+func (p *Processor) Save() error {
+	content, err := p.Encode()
+	if err != nil {
+		return fmt.Errorf("encode %s: %w", p.outputName(), err)
+	}
+	return p.save(content)
+}
+
+// save writes the encoded TD of this processor and the TDs of the
+// linked submodels
+func (p *Processor) save(content []byte) error {
 	switch p.outputDir {
 	case "-":
-		fmt.Println(prt.String())
+		if _, err := os.Stdout.Write(content); err != nil {
+			return err
+		}
 	case "":
 	default:
-		err := os.MkdirAll(p.outputDir, 0777)
-		check(err)
-		filename := strings.Replace(p.filename, ".tm.", ".td.", 1)
-		err = os.WriteFile(filepath.Join(p.outputDir, filename), prt.ByteArr(), 0644)
-		check(err)
+		if err := os.MkdirAll(p.outputDir, 0777); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(p.outputDir, p.outputName()), content, 0644); err != nil {
+			return err
+		}
 	}
+	if p.submodelMode == SubmodelLink {
+		for _, item := range p.items {
+			if err := item.Save(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
+// extendAll merges the already processed extended models into
+// the data of this processor. The definitions of the extending
+// model override the ones of the extended model.
 func (p *Processor) extendAll() {
+	destMap := p.data.(*Object)
 	for _, e := range p.extensions {
-		destMap := p.data.(map[string]any)
-		propDest := destMap["properties"].(map[string]any)
-		srcMap := e.data.(map[string]any)
-		propSrc := srcMap["properties"].(map[string]any)
-		merge(propDest, propSrc, 0)
-	}
-	required, ok := p.data.(map[string]any)["tm:required"]
-	delete(p.data.(map[string]any), "tm:required")
-	if ok {
-		requiredArray := required.([]any)
-		for _, requiredElement := range requiredArray {
-			requiredString := requiredElement.(string)
-			requiredString = strings.Replace(requiredString, "#/", "$.", 1)
-			_, notFoundErr := jsonpath.Get(requiredString, p.data)
-			if notFoundErr != nil {
-				slog.Debug(fmt.Sprintf("Required %s", requiredString), "error", notFoundErr)
+		srcMap, ok := e.data.(*Object)
+		if !ok {
+			slog.Error("extended model is not a json object", "level", e.extentLevel)
+			continue
+		}
+		extend(destMap, srcMap)
+		p.required = append(p.required, e.required...)
+		p.optional = append(p.optional, e.optional...)
+		p.inheritOrigins(e.origins, func(ptr string) string { return ptr })
+	}
+}
+
+// extend merges the top level of an extended model into the extending
+// one following the tm:extends rules of TM 1.1: @context is
+// united, links are not inherited and all other members are merged
+// recursively where the extending model wins.
+func extend(dest *Object, src *Object) {
+	for _, key := range src.Keys() {
+		srcElement := src.Value(key)
+		dstElement, found := dest.Get(key)
+		switch key {
+		case "links":
+			// links describe the extended model itself
+		case "@context":
+			dest.Set(key, mergeContext(dstElement, srcElement))
+		default:
+			if found {
+				merge(dstElement, srcElement, 1)
+			} else {
+				dest.Set(key, srcElement)
+			}
+		}
+	}
+}
+
+// tdContexts are the TD context URIs in the order the TD schema requires
+// them at the start of an @context array
+var tdContexts = []string{"https://www.w3.org/2019/wot/td/v1", "https://www.w3.org/2022/wot/td/v1.1"}
+
+// mergeContext unites two @context values without duplicates,
+// keeping the entries of dest first. Members of object entries
+// already defined with the same value are dropped. The TD contexts
+// are moved to the front, e.g. a model of TD 1.1 extending a model
+// of TD 1.0 gets [v1, v1.1, extensions...].
+func mergeContext(dest any, src any) any {
+	ctx := mergeArrayUnique(dest, nil)
+	for _, entry := range asArray(src) {
+		if obj, isObj := entry.(*Object); isObj {
+			entry = undefinedTerms(ctx, obj)
+			if entry.(*Object).Len() == 0 {
+				continue
 			}
 		}
+		ctx = mergeArrayUnique(ctx, []any{entry})
+	}
+	var td, extensions []any
+	for _, uri := range tdContexts {
+		if slices.Contains(ctx, any(uri)) {
+			td = append(td, uri)
+		}
+	}
+	for _, entry := range ctx {
+		if uri, isString := entry.(string); !isString || !slices.Contains(tdContexts, uri) {
+			extensions = append(extensions, entry)
+		}
+	}
+	ctx = append(td, extensions...)
+	if len(ctx) == 1 {
+		if _, isString := ctx[0].(string); isString {
+			return ctx[0]
+		}
+	}
+	return ctx
+}
+
+// undefinedTerms returns the members of obj, which are not defined
+// with the same value by an object entry of ctx
+func undefinedTerms(ctx []any, obj *Object) *Object {
+	res := NewObject()
+	for _, key := range obj.Keys() {
+		defined := slices.ContainsFunc(ctx, func(e any) bool {
+			o, isObj := e.(*Object)
+			return isObj && o.Has(key) && reflect.DeepEqual(o.Value(key), obj.Value(key))
+		})
+		if !defined {
+			res.Set(key, obj.Value(key))
+		}
+	}
+	return res
+}
+
+// mergeArrayUnique appends the elements of src which are not already
+// in dest. Single values are treated as arrays of one element.
+func mergeArrayUnique(dest any, src any) []any {
+	res := append(make([]any, 0), asArray(dest)...)
+	for _, s := range asArray(src) {
+		if !slices.ContainsFunc(res, func(e any) bool { return reflect.DeepEqual(e, s) }) {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+func asArray(v any) []any {
+	switch a := v.(type) {
+	case nil:
+		return []any{}
+	case []any:
+		return a
+	default:
+		return []any{a}
 	}
 }
 
+// insertTypeLink links the TD with its model, the media type follows
+// the format of the model
 func (p *Processor) insertTypeLink() {
-	destMap := p.data.(map[string]any)
-	linksAny, ok := destMap["links"]
-	links := linksAny.([]any)
-	if !ok {
+	mediaType := "application/tm+json"
+	if isYAML(p.filename) {
+		mediaType = "application/yaml"
+	}
+	p.appendLink(Link{Rel: "type", Href: p.filename, Type: mediaType})
+}
+
+func (p *Processor) appendLink(link Link) {
+	destMap := p.data.(*Object)
+	linksAny, ok := destMap.Get("links")
+	links, isArray := linksAny.([]any)
+	if !ok || !isArray {
 		links = make([]any, 0, 1)
-		destMap["links"] = links
 	}
-	typelink, _ := structToMap(Link{Rel: "type", Href: p.filename, Type: "application/tm+json"})
-	destMap["links"] = append(links, typelink)
+	linkMap, _ := structToObject(link)
+	destMap.Set("links", append(links, linkMap))
 }
 
 func merge(dest any, src any, deep int) {
 	switch d := dest.(type) {
-	case map[string]any:
-		srcData, ok := src.(map[string]any)
+	case *Object:
+		srcData, ok := src.(*Object)
 		if !ok {
 			if isInteractiv() {
-				fmt.Printf("datatype not a map, skip %T", srcData)
+				fmt.Printf("datatype not a map, skip %T", src)
 			} else {
-				slog.Error(fmt.Sprintf("datatype not a map, skip %T", srcData))
+				slog.Error(fmt.Sprintf("datatype not a map, skip %T", src))
 			}
+			return
 		}
-		for key, element := range srcData {
-			if dstElement, ok := d[key]; ok {
+		for _, key := range srcData.Keys() {
+			element := srcData.Value(key)
+			if dstElement, ok := d.Get(key); ok {
 				merge(dstElement, element, deep+1)
 			} else {
-				d[key] = element
+				d.Set(key, element)
 			}
 		}
 	case []any:
@@ -229,108 +565,187 @@ func merge(dest any, src any, deep int) {
 
 }
 
-func (p *Processor) iterate(data any, po *PathObject) {
+func (p *Processor) iterate(data any, po *PathObject) error {
+	var errs []error
 	if po.Deep() == 0 {
 		slog.Debug(fmt.Sprintf("%siterate %T", indent(po.Deep()), data), "path", po.String(), "deep", po.Deep(), "inst", p.instance.String())
 	}
 	switch d := data.(type) {
-	case map[string]any:
-		toDel := make([]string, 0)
-		for key, element := range d {
+	case *Object:
+		for _, key := range d.Keys() {
+			if key == "tm:ref" {
+				continue
+			}
+			element := d.Value(key)
 			po.AddMap(key)
 			if po.IsPath("links") {
-				d[key] = p.processLinks(po, key, element)
-			} else if po.IsPath("properties/.*/tm.ref") {
-				p.processReference(po, key, element, d)
-				toDel = append(toDel, key)
+				links, err := p.processLinks(po, key, element)
+				errs = append(errs, err)
+				d.Set(key, links)
 			} else {
-				p.iterate(element, po)
+				errs = append(errs, p.iterate(element, po))
 			}
 			po.Up()
-			for _, k := range toDel {
-				delete(d, k)
-			}
+		}
+		if ref, ok := d.Get("tm:ref"); ok {
+			po.AddMap("tm:ref")
+			errs = append(errs, p.processReference(po, ref, d, p.location, p.data, nil))
+			po.Up()
 		}
 	case []any:
 		for i, ele := range d {
 			po.AddArray(i)
-			p.iterate(ele, po)
+			errs = append(errs, p.iterate(ele, po))
 			po.Up()
 		}
 	}
 	if po.Deep() == 0 {
 		slog.Debug(fmt.Sprintf("%sprocess end  %T", indent(po.Deep()), data), "path", po.String(), "deep", po.Deep())
 	}
+	return errors.Join(errs...)
 }
 
-func (p *Processor) processLinks(po *PathObject, key string, element any) []any {
+func (p *Processor) processLinks(po *PathObject, key string, element any) ([]any, error) {
 	links := element.([]any)
 	returnLinks := make([]any, 0, len(links))
+	var errs []error
 	for _, ele := range links {
-		li := ele.(map[string]any)
-		if val, ok := li["rel"]; ok && val == "tm:extends" {
+		li := ele.(*Object)
+		if val, ok := li.Get("rel"); ok && val == "tm:extends" {
 			p.foundTMStaff = true
-			fileName := li["href"].(string)
-
-			extend, loadError := p.loadFile(fileName)
-			p.extensions = append(p.extensions, Extension{extentLevel: po.Deep(), data: extend})
-			if loadError != nil {
-				slog.Error("unable to read extension", "filname", fileName, "error", loadError)
+			fileName := li.Value("href").(string)
+			pExt := p.newExtensionProcessor()
+			err := pExt.Process(fileName)
+			p.recordLink(EdgeExtends, fileName, pExt, "")
+			if err != nil {
+				errs = append(errs, fmt.Errorf("unable to process extension %s: %w", fileName, err))
+				continue
 			}
-			p.extensions = append(p.extensions, Extension{extentLevel: po.Deep(), data: extend})
-		} else if val, ok := li["rel"]; ok && val == "tm:submodel" {
+			p.extensions = append(p.extensions, Extension{extentLevel: po.Deep(), data: pExt.data,
+				required: pExt.required, optional: pExt.optional, origins: pExt.origins})
+			p.adoptItems(pExt)
+		} else if val, ok := li.Get("rel"); ok && val == "tm:submodel" {
 			p.foundTMStaff = true
-			fileName := li["href"].(string)
+			fileName := li.Value("href").(string)
 			pSub := p.NewProcessor()
-			if val, ok := li["instanceName"]; ok {
-				pSub.instance.AddMap(val.(string))
-			} else {
-				pSub.instance.AddMap("")
+			instanceName, _ := li.Value("instanceName").(string)
+			pSub.instance.AddMap(instanceName)
+			pSub.VarMap = scopedVarMap(p.VarMap, instanceName)
+			if scope, ok := p.VarMap.Value(instanceName).(*Object); ok && p.submodelMode == SubmodelLink {
+				pSub.drop, _ = stringList(scope.Value(VarDropOptional))
 			}
+			slog.Debug("variable scope", "instance", instanceName, "vars", pSub.VarMap)
 			err := pSub.Process(fileName)
+			p.recordLink(EdgeSubmodel, fileName, pSub, instanceName)
 			if err != nil {
-				slog.Error("error while processing submodel", "filname", fileName, "error", err)
+				errs = append(errs, fmt.Errorf("unable to process submodel %s: %w", fileName, err))
 			}
 		} else {
 			returnLinks = append(returnLinks, ele)
-			p.iterate(ele, po)
+			errs = append(errs, p.iterate(ele, po))
 		}
 	}
-	return returnLinks
+	// flattened submodels have appended their links to the section
+	if section, ok := p.data.(*Object).Value(key).([]any); ok && len(section) > len(links) {
+		returnLinks = mergeArrayUnique(returnLinks, section[len(links):])
+	}
+	return returnLinks, errors.Join(errs...)
 }
 
-func (p *Processor) processReference(po *PathObject, key string, element any, d map[string]any) {
-	ref := strings.Split(element.(string), "#")
-	refData, rerr := p.loadFile(ref[0])
-	if rerr != nil {
-		log.Printf("unable to read reference file: %v\n", rerr)
-	} else {
-		jpExpr := fmt.Sprintf("$.%s", strings.ReplaceAll(ref[1], "/", "."))
-		refDataPart, errp := jsonpath.Get(jpExpr, refData)
-		if errp != nil {
-			log.Printf("path %s not found in file %s : %v\n", jpExpr, ref[0], errp)
-		} else {
-			merge(d, refDataPart, po.Deep())
+// processReference replaces the tm:ref member of target by the referenced
+// definition. Members of target override the referenced ones. References
+// without a file part like "#/properties/x" point into doc, other files
+// are resolved relative to docLocation. refs is the chain of references
+// currently resolved.
+func (p *Processor) processReference(po *PathObject, element any, target *Object, docLocation string, doc any, refs []string) error {
+	ref, ok := element.(string)
+	if !ok {
+		return fmt.Errorf("%s: tm:ref must be a string, found %T", po.String(), element)
+	}
+	refFile, fragment, _ := strings.Cut(ref, "#")
+	ptr, err := fragmentToPointer(fragment)
+	if err != nil {
+		return fmt.Errorf("%s: %w", po.String(), err)
+	}
+	refLocation, refData := docLocation, doc
+	if refFile != "" {
+		refData, refLocation, err = p.loadFile(refFile, docLocation)
+		p.recordReference(docLocation, refFile, refLocation, refData, ptr)
+		if err != nil {
+			return fmt.Errorf("%s: unable to read reference file: %w", po.String(), err)
+		}
+		if err = p.validateModel(refLocation, refData); err != nil {
+			return fmt.Errorf("%s: %w", po.String(), err)
+		}
+	}
+	refs, err = p.pushReference(refs, refLocation+"#"+ptr)
+	if err != nil {
+		return fmt.Errorf("%s: %w", po.String(), err)
+	}
+	refDataPart, err := resolvePointer(refData, ptr)
+	if err != nil {
+		return fmt.Errorf("%s: %s not resolvable in %s: %w", po.String(), ref, refLocation, err)
+	}
+	if d {
+		slog.Debug("resolve tm:ref", "ref", ref, "path", po.String())
+	}
+	// the referenced part may contain references relative to its own file
+	refDataPart = deepCopy(refDataPart)
+	tokens, _ := parsePointer(ptr)
+	err = p.resolveReferences(refDataPart, &PathObject{path: tokens}, refLocation, refData, refs)
+	if err != nil {
+		return fmt.Errorf("%s: %w", po.String(), err)
+	}
+	target.Delete("tm:ref")
+	merge(target, refDataPart, po.Deep())
+	return nil
+}
+
+// resolveReferences replaces all tm:ref members in data, which is a
+// part of the document doc loaded from docLocation.
+func (p *Processor) resolveReferences(data any, po *PathObject, docLocation string, doc any, refs []string) error {
+	var errs []error
+	switch d := data.(type) {
+	case *Object:
+		for _, key := range d.Keys() {
+			if key == "tm:ref" {
+				continue
+			}
+			po.AddMap(key)
+			errs = append(errs, p.resolveReferences(d.Value(key), po, docLocation, doc, refs))
+			po.Up()
+		}
+		if ref, ok := d.Get("tm:ref"); ok {
+			po.AddMap("tm:ref")
+			errs = append(errs, p.processReference(po, ref, d, docLocation, doc, refs))
+			po.Up()
+		}
+	case []any:
+		for i, ele := range d {
+			po.AddArray(i)
+			errs = append(errs, p.resolveReferences(ele, po, docLocation, doc, refs))
+			po.Up()
 		}
 	}
+	return errors.Join(errs...)
 }
 
 func (p *Processor) checkVersionInstance() {
-	rootMap := p.data.(map[string]any)
-	version, ok := rootMap["version"]
+	rootMap := p.data.(*Object)
+	version, ok := rootMap.Get("version")
 	if ok {
 		instVersion := "0.0.0"
-		if varsVersion, inVars := p.VarMap["versionInstance"]; inVars {
+		if varsVersion, inVars := p.VarMap.Get("versionInstance"); inVars {
 			instVersion = varsVersion.(string)
 		}
-		versionMap, okVM := version.(map[string]any)
+		versionMap, okVM := version.(*Object)
 		if okVM {
-			instance, okI := versionMap["instance"]
+			instance, okI := versionMap.Get("instance")
 			if okI {
 				instVersion, _ = instance.(string)
 			}
+			versionMap.Set("instance", instVersion)
 		}
-		versionMap["instance"] = instVersion
 	}
 }
 
@@ -17,66 +17,224 @@ limitations under the License.
 package process
 
 import (
-	"log"
-	"log/slog"
+	"fmt"
+	"slices"
 	"strings"
 )
 
 type Processor struct {
+	settings
 	extensions []Extension
 	// track if further action is required
 	foundTMStaff bool
-	VarMap       map[string]any
-	outputDir    string
-	inputPath    []string
 	parent       *Processor
 	items        []*Processor
 	data         any
 	filename     string
 	instance     PathObject
+	// set if this processor loads a model extended by another processor
+	extendedBy *Processor
+	required   []Requirement
+	optional   []string
+	// optional affordances to remove from the thing description
+	drop   []string
+	loaded *loadedFiles
+	// absolute path or URL of the loaded model
+	location string
+	// locations of the models leading to this one
+	stack []string
+	// model file of each affordance and top level member
+	origins map[string]string
+	// name of the written TD, overrides the name derived from the model
+	output string
+	// records the dependencies of the models, if set
+	graph *ModelGraph
+}
+
+// settings are the options of a processor, which apply to the model
+// and to all extended, sub- and referenced models
+type settings struct {
+	VarMap       *Object
+	outputDir    string
+	inputPath    []string
+	submodelMode SubmodelMode
+	resolver     Resolver
+	maxDepth     int
+	// indentation of the written TD, empty for compact JSON
+	indent string
+	// write the members in the order of the models
+	keepOrder bool
+	format    string
+	// write the names of TD terms as integers in CBOR
+	compressKeys bool
+	// JSON-LD form of the written TD, expand or compact
+	jsonld string
+	// generates the forms of affordances without forms
+	binding *Binding
+	// check the loaded thing models against the TM JSON schema
+	validateModels bool
+	// limits the documents the models may load, unrestricted if nil
+	hrefRestriction *HrefRestriction
 }
 
-func NewProcessor(out string, in string, vars string) *Processor {
+func NewProcessor(out string, in string) *Processor {
 	np := Processor{
-		outputDir: out,
-		items:     make([]*Processor, 0, 20)}
+		settings: settings{
+			outputDir:    out,
+			submodelMode: SubmodelFlatten,
+			resolver:     NewHTTPResolver(DefaultCacheDir(), false),
+			maxDepth:     DefaultMaxDepth,
+			indent:       DefaultIndent,
+			format:       FormatJSON},
+		items:  make([]*Processor, 0, 20),
+		loaded: &loadedFiles{}}
 	np.SetInputPath(in)
-	np.SetPlaceholderMap(vars)
 
 	return &np
 }
 
+// withSettings creates a processor with the settings of p
+func (p *Processor) withSettings() *Processor {
+	return &Processor{settings: p.settings, items: make([]*Processor, 0, 20)}
+}
+
 func (p *Processor) NewProcessor() *Processor {
-	np := &Processor{outputDir: p.outputDir,
-		inputPath: p.inputPath,
-		VarMap:    p.VarMap}
+	np := p.withSettings()
+	np.loaded, np.stack, np.graph = p.loaded, p.stack, p.graph
 	p.items = append(p.items, np)
 	np.parent = p
 	return np
 }
 
+// newExtensionProcessor creates a processor for a model referenced
+// by tm:extends. Its result is merged into p instead of being copied.
+func (p *Processor) newExtensionProcessor() *Processor {
+	np := p.withSettings()
+	np.loaded, np.stack, np.graph = p.loaded, p.stack, p.graph
+	np.extendedBy = p
+	np.instance.path = slices.Clone(p.instance.path)
+	return np
+}
+
+// SetIndent sets the indentation of the written TDs,
+// an empty indent writes compact JSON.
+func (p *Processor) SetIndent(indent string) {
+	p.indent = indent
+}
+
+// SetKeepOrder writes the members of the TD in the order of the models
+// instead of the TD order with sorted nested members.
+func (p *Processor) SetKeepOrder(keepOrder bool) {
+	p.keepOrder = keepOrder
+}
+
+// SetFormat selects the format of the written TDs, json, yaml, cbor
+// or one of the RDF formats ntriples and turtle
+func (p *Processor) SetFormat(format string) error {
+	switch format {
+	case FormatJSON, FormatYAML, FormatCBOR, FormatNTriples, FormatTurtle:
+		p.format = format
+		return nil
+	case "":
+		p.format = FormatJSON
+		return nil
+	}
+	return fmt.Errorf("unknown format '%s', use %s, %s, %s, %s or %s", format, FormatJSON, FormatYAML, FormatCBOR, FormatNTriples, FormatTurtle)
+}
+
+// SetJSONLD writes the TDs in expanded or compacted JSON-LD form,
+// the compacted form uses the @context of the TD.
+func (p *Processor) SetJSONLD(mode string) error {
+	switch mode {
+	case JSONLDExpand, JSONLDCompact, "":
+		p.jsonld = mode
+		return nil
+	}
+	return fmt.Errorf("unknown JSON-LD form '%s', use %s or %s", mode, JSONLDExpand, JSONLDCompact)
+}
+
+// SetKeyCompression writes the names of common TD terms as
+// integers, if the TDs are written as CBOR.
+func (p *Processor) SetKeyCompression(compress bool) {
+	p.compressKeys = compress
+}
+
 func (p *Processor) SetOutputDir(outputDir string) {
 	p.outputDir = outputDir
 }
 
+// SetDropOptional selects optional affordances, which are removed
+// from the thing description, e.g. "#/properties/status".
+func (p *Processor) SetDropOptional(pointers []string) {
+	p.drop = pointers
+}
+
+// SetValidateModels checks every loaded thing model against the TM
+// JSON schema before it is processed
+func (p *Processor) SetValidateModels(validate bool) {
+	p.validateModels = validate
+}
+
+// SetResolver replaces the resolver for models referenced by http(s) URLs.
+// It has to be set before the placeholder map is loaded from a remote location.
+func (p *Processor) SetResolver(r Resolver) {
+	p.resolver = r
+}
+
 func (p *Processor) SetInputPath(searchPath string) {
 	p.inputPath = strings.Split(searchPath, ",")
 }
 
-func (p *Processor) SetPlaceholderMap(filename string) {
-	if filename != "" {
-		varMapAny, err := p.loadFile(filename)
-		if err != nil {
-			slog.Error("load varMapFile", "filename", filename, "error", err)
-			return
-		}
-		varMap, ok := varMapAny.(map[string]any)
-		if !ok {
-			log.Printf("varMapFile don't contain a map of values\n")
-			return
+// SetPlaceholderMap loads the values of the placeholders from a json or
+// yaml file, an empty filename keeps the current values
+func (p *Processor) SetPlaceholderMap(filename string) error {
+	if filename == "" {
+		return nil
+	}
+	varMapAny, _, err := p.loadFile(filename, "")
+	if err != nil {
+		return fmt.Errorf("load varmap: %w", err)
+	}
+	varMap, ok := varMapAny.(*Object)
+	if !ok {
+		return fmt.Errorf("varmap %s is not a map of values", filename)
+	}
+	p.VarMap = varMap
+	return nil
+}
+
+// AddPlaceholders overlays the values of vars onto the placeholder map,
+// nested maps are merged.
+func (p *Processor) AddPlaceholders(vars *Object) {
+	p.VarMap = overlayVars(p.VarMap, vars)
+}
+
+// scopedVarMap returns the placeholder map of a submodel instance.
+// Values in a map named like the instance override the values of
+// the parent scope for the submodel and its descendants.
+func scopedVarMap(vars *Object, instanceName string) *Object {
+	scoped, ok := vars.Value(instanceName).(*Object)
+	if !ok {
+		return vars
+	}
+	return overlayVars(vars, scoped)
+}
+
+// overlayVars merges two placeholder maps into a new one, nested maps
+// are merged recursively and values of top win.
+func overlayVars(base *Object, top *Object) *Object {
+	res := base.Clone()
+	for _, key := range top.Keys() {
+		value := top.Value(key)
+		baseMap, baseIsMap := res.Value(key).(*Object)
+		topMap, topIsMap := value.(*Object)
+		if baseIsMap && topIsMap {
+			res.Set(key, overlayVars(baseMap, topMap))
+		} else {
+			res.Set(key, value)
 		}
-		p.VarMap = varMap
 	}
+	return res
 }
 
 func (p *Processor) String() string {
@@ -0,0 +1,127 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	tdV1  = "https://www.w3.org/2019/wot/td/v1"
+	tdV11 = "https://www.w3.org/2022/wot/td/v1.1"
+)
+
+func TestMergeContext(t *testing.T) {
+	ext, _ := decodeJSON([]byte(`{"saref": "https://w3id.org/saref#"}`))
+	tests := []struct {
+		name string
+		dest any
+		src  any
+		want any
+	}{
+		{"same", tdV11, tdV11, tdV11},
+		{"v1.1 extends v1", []any{tdV11, ext}, tdV1, []any{tdV1, tdV11, ext}},
+		{"v1 extends v1.1", tdV1, []any{tdV11}, []any{tdV1, tdV11}},
+		{"extension first", []any{ext, tdV11}, nil, []any{tdV11, ext}},
+		{"duplicate terms", []any{tdV11, ext}, []any{tdV11, ext}, []any{tdV11, ext}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeContext(tt.dest, tt.src)
+			if changes := DiffDocuments(tt.want, got); len(changes) > 0 {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// buildModel builds a model of the example directory and validates the
+// models and the TD like "tmtd build -s model -m <varmap> --binding <binding>"
+func buildModel(t *testing.T, model string, varmap string, binding string) *Processor {
+	t.Helper()
+	p := NewProcessor("", "../../model")
+	p.SetResolver(NewHTTPResolver(t.TempDir(), true))
+	p.SetValidateModels(true)
+	if err := errors.Join(p.SetPlaceholderMap(varmap), p.SetBinding(binding)); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Process(model); err != nil {
+		t.Fatalf("build %s: %v", model, err)
+	}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("validate %s: %v", model, err)
+	}
+	return p
+}
+
+func TestBuildFlattenedSubmodels(t *testing.T) {
+	td := buildModel(t, "SmartVentilator.tm.jsonld", "vars.json", "binding-http.json").TD()
+	security, _ := td.Value("security").([]any)
+	want := []any{"ventilation_basic_sc", "led_basic_sc"}
+	if len(DiffDocuments(want, security)) > 0 {
+		t.Errorf("got the security %v, want %v", security, want)
+	}
+	var hrefs []any
+	links, _ := td.Value("links").([]any)
+	for _, l := range links {
+		link, ok := l.(*Object)
+		if !ok {
+			t.Fatalf("link %v is not an object", l)
+		}
+		hrefs = append(hrefs, link.Value("href"))
+	}
+	want = []any{"./SmartVentilation.td.jsonld", "./Ventilation.tm.jsonld", "./LED.tm.jsonld", "SmartVentilator.tm.jsonld"}
+	if len(DiffDocuments(want, hrefs)) > 0 {
+		t.Errorf("got the links %v, want %v", hrefs, want)
+	}
+}
+
+func TestBuildYAMLModel(t *testing.T) {
+	td := buildModel(t, "lamp.tm.yaml", "vars.yaml", "binding-http.json").TD()
+	if title := td.Value("title"); title != "Lamp kitchen" {
+		t.Errorf("got the title %v, want Lamp kitchen", title)
+	}
+	if ctx := td.Value("@context"); len(DiffDocuments(tdV1, asArray(ctx)[0])) > 0 {
+		t.Errorf("got the @context %v, want %s first", ctx, tdV1)
+	}
+	links, _ := td.Value("links").([]any)
+	if len(links) != 1 {
+		t.Fatalf("got the links %v, want the type link", links)
+	}
+	if typ := links[0].(*Object).Value("type"); typ != "application/yaml" {
+		t.Errorf("got the type link media type %v, want application/yaml", typ)
+	}
+}
+
+func TestSetPlaceholderMapErrors(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{"broken.json": `{"a": [1,`, "broken.yaml": "a: [1\n", "list.json": `[1]`}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"missing.json", "broken.json", "broken.yaml", "list.json"} {
+		p := NewProcessor("", dir)
+		if err := p.SetPlaceholderMap(name); err == nil {
+			t.Errorf("varmap %s: got no error", name)
+		}
+	}
+}
@@ -0,0 +1,370 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	rdfNS        = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	xsdNS        = "http://www.w3.org/2001/XMLSchema#"
+	rdfType      = rdfNS + "type"
+	xsdString    = xsdNS + "string"
+	xsdInteger   = xsdNS + "integer"
+	xsdDouble    = xsdNS + "double"
+	xsdBoolean   = xsdNS + "boolean"
+	rdfLangStr   = rdfNS + "langString"
+	rdfJSON      = rdfNS + "JSON"
+	rdfFirst     = rdfNS + "first"
+	rdfRest      = rdfNS + "rest"
+	rdfNil       = rdfNS + "nil"
+	blankNodeTag = "_:"
+)
+
+var (
+	integerLexicalPattern = regexp.MustCompile(`^[-+]?[0-9]+$`)
+	turtleLocalPattern    = regexp.MustCompile(`^[A-Za-z0-9_]([A-Za-z0-9_.-]*[A-Za-z0-9_-])?$`)
+)
+
+// rdfTerm is an IRI, a blank node (value starting with _:) or a literal
+type rdfTerm struct {
+	value    string
+	literal  bool
+	datatype string
+	language string
+}
+
+type triple struct {
+	subject   rdfTerm
+	predicate rdfTerm
+	object    rdfTerm
+}
+
+// rdfGraph converts expanded JSON-LD into triples
+type rdfGraph struct {
+	triples []triple
+	blanks  int
+}
+
+// toTriples returns the triples of an expanded document.
+// Triples with relative IRIs are dropped.
+func toTriples(expanded []any) []triple {
+	g := &rdfGraph{}
+	for _, node := range expanded {
+		if n, ok := node.(*Object); ok {
+			g.node(n)
+		}
+	}
+	return g.triples
+}
+
+func (g *rdfGraph) blankNode() rdfTerm {
+	g.blanks++
+	return rdfTerm{value: fmt.Sprintf("%sb%d", blankNodeTag, g.blanks-1)}
+}
+
+func (g *rdfGraph) add(s rdfTerm, p rdfTerm, o rdfTerm) {
+	for _, t := range []rdfTerm{s, p, o} {
+		if !t.literal && !strings.HasPrefix(t.value, blankNodeTag) && !absoluteIRIPattern.MatchString(t.value) {
+			return
+		}
+	}
+	g.triples = append(g.triples, triple{subject: s, predicate: p, object: o})
+}
+
+// node adds the triples of a node object and returns its subject
+func (g *rdfGraph) node(n *Object) rdfTerm {
+	var subject rdfTerm
+	if id, ok := n.Value("@id").(string); ok {
+		subject = rdfTerm{value: id}
+	} else {
+		subject = g.blankNode()
+	}
+	for _, t := range asArray(n.Value("@type")) {
+		if s, ok := t.(string); ok {
+			g.add(subject, rdfTerm{value: rdfType}, rdfTerm{value: s})
+		}
+	}
+	for _, prop := range n.Keys() {
+		if isKeyword(prop) {
+			continue
+		}
+		for _, v := range asArray(n.Value(prop)) {
+			if o, ok := g.object(v); ok {
+				g.add(subject, rdfTerm{value: prop}, o)
+			}
+		}
+	}
+	return subject
+}
+
+func (g *rdfGraph) object(v any) (rdfTerm, bool) {
+	o, ok := v.(*Object)
+	if !ok {
+		return rdfTerm{}, false
+	}
+	switch {
+	case o.Has("@value"):
+		return literalTerm(o)
+	case o.Has("@list"):
+		return g.list(asArray(o.Value("@list"))), true
+	default:
+		return g.node(o), true
+	}
+}
+
+// list adds the rdf:first/rdf:rest chain of a list
+func (g *rdfGraph) list(items []any) rdfTerm {
+	head := rdfTerm{value: rdfNil}
+	terms := make([]rdfTerm, 0, len(items))
+	for _, item := range items {
+		if t, ok := g.object(item); ok {
+			terms = append(terms, t)
+		}
+	}
+	if len(terms) == 0 {
+		return head
+	}
+	nodes := make([]rdfTerm, len(terms))
+	for i := range terms {
+		nodes[i] = g.blankNode()
+	}
+	for i, t := range terms {
+		rest := head
+		if i+1 < len(nodes) {
+			rest = nodes[i+1]
+		}
+		g.add(nodes[i], rdfTerm{value: rdfFirst}, t)
+		g.add(nodes[i], rdfTerm{value: rdfRest}, rest)
+	}
+	return nodes[0]
+}
+
+func literalTerm(o *Object) (rdfTerm, bool) {
+	value := o.Value("@value")
+	typ, _ := o.Value("@type").(string)
+	if typ == "@json" {
+		enc := NewEncoder("")
+		content, err := enc.Encode(value)
+		if err != nil {
+			return rdfTerm{}, false
+		}
+		return rdfTerm{value: string(content), literal: true, datatype: rdfJSON}, true
+	}
+	t := rdfTerm{literal: true, datatype: typ}
+	switch v := value.(type) {
+	case string:
+		t.value = v
+		if lang, ok := o.Value("@language").(string); ok {
+			t.language, t.datatype = lang, rdfLangStr
+		}
+	case bool:
+		t.value = strconv.FormatBool(v)
+		if t.datatype == "" {
+			t.datatype = xsdBoolean
+		}
+	case json.Number:
+		isInteger := integerLexicalPattern.MatchString(v.String())
+		if isInteger && (t.datatype == "" || t.datatype == xsdInteger) {
+			t.value, t.datatype = strings.TrimPrefix(v.String(), "+"), xsdInteger
+		} else {
+			f, err := v.Float64()
+			if err != nil {
+				return rdfTerm{}, false
+			}
+			t.value = canonicalDouble(f)
+			if t.datatype == "" {
+				t.datatype = xsdDouble
+			}
+		}
+	default:
+		return rdfTerm{}, false
+	}
+	if t.datatype == "" {
+		t.datatype = xsdString
+	}
+	return t, true
+}
+
+// canonicalDouble formats a number as canonical xsd:double like 1.5E0
+func canonicalDouble(f float64) string {
+	s := strconv.FormatFloat(f, 'E', -1, 64)
+	mantissa, exponent, _ := strings.Cut(s, "E")
+	if !strings.Contains(mantissa, ".") {
+		mantissa += ".0"
+	}
+	exp, _ := strconv.Atoi(exponent)
+	return mantissa + "E" + strconv.Itoa(exp)
+}
+
+func escapeRDFString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	return b.String()
+}
+
+func (t rdfTerm) nTriples() string {
+	switch {
+	case t.literal:
+		s := `"` + escapeRDFString(t.value) + `"`
+		if t.language != "" {
+			return s + "@" + t.language
+		}
+		if t.datatype != xsdString {
+			return s + "^^<" + t.datatype + ">"
+		}
+		return s
+	case strings.HasPrefix(t.value, blankNodeTag):
+		return t.value
+	}
+	return "<" + t.value + ">"
+}
+
+// encodeNTriples writes triples as N-Triples
+func encodeNTriples(triples []triple) []byte {
+	var buf bytes.Buffer
+	for _, t := range triples {
+		fmt.Fprintf(&buf, "%s %s %s .\n", t.subject.nTriples(), t.predicate.nTriples(), t.object.nTriples())
+	}
+	return buf.Bytes()
+}
+
+// turtleWriter abbreviates IRIs with the prefixes of the TD context
+type turtleWriter struct {
+	prefixes map[string]string
+	used     map[string]bool
+}
+
+func (w *turtleWriter) iri(iri string) string {
+	best := ""
+	for name, ns := range w.prefixes {
+		if !strings.HasPrefix(iri, ns) {
+			continue
+		}
+		local := iri[len(ns):]
+		if local != "" && !turtleLocalPattern.MatchString(local) {
+			continue
+		}
+		if best == "" || len(ns) > len(w.prefixes[best]) || (len(ns) == len(w.prefixes[best]) && name < best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return "<" + iri + ">"
+	}
+	w.used[best] = true
+	return best + ":" + iri[len(w.prefixes[best]):]
+}
+
+func (w *turtleWriter) term(t rdfTerm) string {
+	switch {
+	case t.literal:
+		switch t.datatype {
+		case xsdInteger, xsdBoolean, xsdDouble:
+			return t.value
+		case xsdString:
+			return `"` + escapeRDFString(t.value) + `"`
+		case rdfLangStr:
+			return `"` + escapeRDFString(t.value) + `"@` + t.language
+		}
+		return `"` + escapeRDFString(t.value) + `"^^` + w.iri(t.datatype)
+	case strings.HasPrefix(t.value, blankNodeTag):
+		return t.value
+	}
+	return w.iri(t.value)
+}
+
+// encodeTurtle writes triples as Turtle grouped by subject. The used
+// prefixes of the given map are declared.
+func encodeTurtle(triples []triple, prefixes map[string]string) []byte {
+	w := &turtleWriter{prefixes: prefixes, used: make(map[string]bool)}
+	subjects := make([]rdfTerm, 0)
+	bySubject := make(map[rdfTerm][]triple)
+	for _, t := range triples {
+		if _, found := bySubject[t.subject]; !found {
+			subjects = append(subjects, t.subject)
+		}
+		bySubject[t.subject] = append(bySubject[t.subject], t)
+	}
+	var body bytes.Buffer
+	for _, s := range subjects {
+		body.WriteString("\n" + w.term(s))
+		for i, t := range bySubject[s] {
+			if i > 0 {
+				body.WriteString(" ;")
+			}
+			predicate := "a"
+			if t.predicate.value != rdfType {
+				predicate = w.term(t.predicate)
+			}
+			fmt.Fprintf(&body, "\n    %s %s", predicate, w.term(t.object))
+		}
+		body.WriteString(" .\n")
+	}
+	var buf bytes.Buffer
+	names := make([]string, 0, len(w.used))
+	for name := range w.used {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		fmt.Fprintf(&buf, "@prefix %s: <%s> .\n", name, prefixes[name])
+	}
+	buf.Write(body.Bytes())
+	return buf.Bytes()
+}
+
+// prefixes returns the prefix terms of a context
+func (ld *jsonLD) prefixes(ctx any) (map[string]string, error) {
+	active, err := ld.processContext(newLDContext(), ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]string)
+	for name, t := range active.terms {
+		if t != nil && t.prefix {
+			res[name] = t.id
+		}
+	}
+	return res, nil
+}
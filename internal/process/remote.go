@@ -0,0 +1,195 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/wot-oss/tmtd/internal/config"
+)
+
+// maximum size of a model loaded over http
+const maxRemoteSize = 10 << 20
+
+// Resolver loads models, which are not located in the local file system
+type Resolver interface {
+	// Fetch returns the content found at the absolute URL location
+	Fetch(location string) ([]byte, error)
+}
+
+// HTTPResolver fetches models with http(s) and keeps them in an on-disk
+// cache. Cached models are revalidated using ETag and Last-Modified.
+type HTTPResolver struct {
+	Client   *http.Client
+	CacheDir string
+	// Offline only uses the cache and never accesses the network
+	Offline bool
+}
+
+// cacheMeta is stored next to a cached model
+type cacheMeta struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+}
+
+// DefaultCacheDir is the directory for cached remote models
+func DefaultCacheDir() string {
+	return filepath.Join(config.DefaultConfigDir, "cache")
+}
+
+func NewHTTPResolver(cacheDir string, offline bool) *HTTPResolver {
+	return &HTTPResolver{
+		Client:   &http.Client{Timeout: 30 * time.Second},
+		CacheDir: cacheDir,
+		Offline:  offline,
+	}
+}
+
+func isRemote(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+func (r *HTTPResolver) Fetch(location string) ([]byte, error) {
+	cached, meta, cacheErr := r.readCache(location)
+	if r.Offline {
+		if cacheErr != nil {
+			return nil, fmt.Errorf("%s is not cached, unable to load it in offline mode", location)
+		}
+		slog.Debug("use cached model", "url", location, "fetched", meta.Fetched)
+		return cached, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/tm+json, application/td+json, application/ld+json, application/json;q=0.9, */*;q=0.1")
+	if cacheErr == nil {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		if cacheErr == nil {
+			slog.Warn("unable to revalidate cached model, use cache", "url", location, "error", err)
+			return cached, nil
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cacheErr == nil:
+		slog.Debug("cached model is up to date", "url", location)
+		return cached, nil
+	case resp.StatusCode == http.StatusOK:
+		content, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(content) > maxRemoteSize {
+			return nil, fmt.Errorf("%s exceeds the maximum size of %d bytes", location, maxRemoteSize)
+		}
+		err = r.writeCache(location, content, cacheMeta{
+			URL:          location,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			Fetched:      time.Now(),
+		})
+		if err != nil {
+			slog.Warn("unable to cache model", "url", location, "error", err)
+		}
+		slog.Info("fetched model", "url", location)
+		return content, nil
+	default:
+		return nil, fmt.Errorf("unable to fetch %s: %s", location, resp.Status)
+	}
+}
+
+func (r *HTTPResolver) cacheFile(location string) string {
+	sum := sha256.Sum256([]byte(location))
+	return filepath.Join(r.CacheDir, hex.EncodeToString(sum[:]))
+}
+
+func (r *HTTPResolver) readCache(location string) ([]byte, cacheMeta, error) {
+	var meta cacheMeta
+	file := r.cacheFile(location)
+	metaContent, err := os.ReadFile(file + ".meta")
+	if err != nil {
+		return nil, meta, err
+	}
+	if err := json.Unmarshal(metaContent, &meta); err != nil {
+		return nil, meta, err
+	}
+	if meta.URL != location {
+		return nil, meta, errors.New("cache entry belongs to a different url")
+	}
+	content, err := os.ReadFile(file)
+	return content, meta, err
+}
+
+func (r *HTTPResolver) writeCache(location string, content []byte, meta cacheMeta) error {
+	err := os.MkdirAll(r.CacheDir, 0755)
+	if err != nil {
+		return err
+	}
+	metaContent, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	file := r.cacheFile(location)
+	err = writeFileAtomic(file, content)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(file+".meta", metaContent)
+}
+
+// writeFileAtomic replaces a cache file by renaming a temporary file, so
+// concurrent builds never read a partially written file
+func writeFileAtomic(file string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(content)
+	err = errors.Join(err, tmp.Chmod(0644), tmp.Close())
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
@@ -0,0 +1,127 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+const (
+	testModel        = `{"@type":"tm:ThingModel","title":"Lamp"}`
+	testETag         = `"v1"`
+	testLastModified = "Mon, 01 Jan 2024 00:00:00 GMT"
+)
+
+// modelServer serves testModel with ETag and Last-Modified and answers
+// conditional requests with 304, it counts the full and the 304 responses
+func modelServer(t *testing.T, validator string) (*httptest.Server, *atomic.Int32, *atomic.Int32) {
+	t.Helper()
+	var full, notModified atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch validator {
+		case "etag":
+			w.Header().Set("ETag", testETag)
+			if r.Header.Get("If-None-Match") == testETag {
+				notModified.Add(1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "last-modified":
+			w.Header().Set("Last-Modified", testLastModified)
+			if r.Header.Get("If-Modified-Since") == testLastModified {
+				notModified.Add(1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		full.Add(1)
+		w.Header().Set("Content-Type", "application/tm+json")
+		_, _ = w.Write([]byte(testModel))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &full, &notModified
+}
+
+func fetch(t *testing.T, r *HTTPResolver, location string) string {
+	t.Helper()
+	content, err := r.Fetch(location)
+	if err != nil {
+		t.Fatalf("fetch %s: %v", location, err)
+	}
+	return string(content)
+}
+
+func TestHTTPResolverFirstFetch(t *testing.T) {
+	srv, full, _ := modelServer(t, "")
+	r := NewHTTPResolver(t.TempDir(), false)
+	if got := fetch(t, r, srv.URL+"/lamp.tm.jsonld"); got != testModel {
+		t.Errorf("got %s, want %s", got, testModel)
+	}
+	if full.Load() != 1 {
+		t.Errorf("got %d requests, want 1", full.Load())
+	}
+	if _, _, err := r.readCache(srv.URL + "/lamp.tm.jsonld"); err != nil {
+		t.Errorf("model not cached: %v", err)
+	}
+}
+
+func TestHTTPResolverRevalidate(t *testing.T) {
+	for _, validator := range []string{"etag", "last-modified"} {
+		t.Run(validator, func(t *testing.T) {
+			srv, full, notModified := modelServer(t, validator)
+			r := NewHTTPResolver(t.TempDir(), false)
+			location := srv.URL + "/lamp.tm.jsonld"
+			fetch(t, r, location)
+			if got := fetch(t, r, location); got != testModel {
+				t.Errorf("got %s from the cache, want %s", got, testModel)
+			}
+			if full.Load() != 1 || notModified.Load() != 1 {
+				t.Errorf("got %d full and %d not modified responses, want 1 and 1", full.Load(), notModified.Load())
+			}
+		})
+	}
+}
+
+func TestHTTPResolverOffline(t *testing.T) {
+	srv, full, _ := modelServer(t, "etag")
+	cacheDir := t.TempDir()
+	location := srv.URL + "/lamp.tm.jsonld"
+	fetch(t, NewHTTPResolver(cacheDir, false), location)
+
+	offline := NewHTTPResolver(cacheDir, true)
+	t.Run("cached", func(t *testing.T) {
+		if got := fetch(t, offline, location); got != testModel {
+			t.Errorf("got %s, want %s", got, testModel)
+		}
+		if full.Load() != 1 {
+			t.Errorf("got %d requests, want no request in offline mode", full.Load())
+		}
+	})
+	t.Run("not cached", func(t *testing.T) {
+		_, err := offline.Fetch(srv.URL + "/other.tm.jsonld")
+		if err == nil || !strings.Contains(err.Error(), "not cached") {
+			t.Errorf("got error %v, want not cached", err)
+		}
+		if full.Load() != 1 {
+			t.Errorf("got %d requests, want no request in offline mode", full.Load())
+		}
+	})
+}
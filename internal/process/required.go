@@ -0,0 +1,174 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// VarDropOptional is the key in the placeholder map holding a list of
+// optional affordances, which are removed from the thing description.
+const VarDropOptional = "tmtd:drop"
+
+// Requirement is an entry of tm:required together with the model
+// file declaring it.
+type Requirement struct {
+	Pointer string
+	Source  string
+}
+
+// RequiredError lists all required affordances missing in a model.
+type RequiredError struct {
+	Missing []Requirement
+}
+
+func (e *RequiredError) Error() string {
+	var b strings.Builder
+	b.WriteString("missing required affordances:")
+	for _, m := range e.Missing {
+		fmt.Fprintf(&b, "\n\t%s (required by %s)", m.Pointer, m.Source)
+	}
+	return b.String()
+}
+
+// collectRequirements removes tm:required and tm:optional from the
+// model and keeps them together with the requirements of the
+// extended models.
+func (p *Processor) collectRequirements() error {
+	rootMap := p.data.(*Object)
+	pointers, err := pointerList(rootMap, "tm:required")
+	if err != nil {
+		return fmt.Errorf("%s: %w", p.filename, err)
+	}
+	for _, ptr := range pointers {
+		p.required = append(p.required, Requirement{Pointer: ptr, Source: p.filename})
+	}
+	pointers, err = pointerList(rootMap, "tm:optional")
+	if err != nil {
+		return fmt.Errorf("%s: %w", p.filename, err)
+	}
+	p.optional = append(p.optional, pointers...)
+	for _, r := range p.required {
+		if slices.Contains(p.optional, r.Pointer) {
+			return fmt.Errorf("%s: %s is declared as required by %s and as optional", p.filename, r.Pointer, r.Source)
+		}
+	}
+	return nil
+}
+
+// pointerList reads and removes a member containing an array of
+// local references like "#/properties/status".
+func pointerList(rootMap *Object, key string) ([]string, error) {
+	listAny, ok := rootMap.Get(key)
+	if !ok {
+		return nil, nil
+	}
+	rootMap.Delete(key)
+	list, ok := listAny.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s must be an array", key)
+	}
+	pointers := make([]string, 0, len(list))
+	for _, element := range list {
+		ptr, ok := element.(string)
+		if !ok || !strings.HasPrefix(ptr, "#") {
+			return nil, fmt.Errorf("%s contains an invalid entry '%v'", key, element)
+		}
+		pointers = append(pointers, ptr)
+	}
+	return pointers, nil
+}
+
+// checkRequired verifies that all required affordances are defined.
+func (p *Processor) checkRequired() error {
+	missing := make([]Requirement, 0)
+	for _, r := range p.required {
+		ptr, err := fragmentToPointer(strings.TrimPrefix(r.Pointer, "#"))
+		if err == nil {
+			_, err = resolvePointer(p.data, ptr)
+		}
+		if err != nil {
+			slog.Debug("required affordance not found", "pointer", r.Pointer, "source", r.Source, "error", err)
+			missing = append(missing, r)
+		}
+	}
+	if len(missing) > 0 {
+		return &RequiredError{Missing: missing}
+	}
+	return nil
+}
+
+// dropOptional removes the selected optional affordances. Selections
+// are taken from the processor and for the top level TD from the
+// placeholder map. They use the names of the generated thing
+// description, e.g. "#/properties/Spot1_on".
+func (p *Processor) dropOptional() error {
+	selection := slices.Clone(p.drop)
+	if p.parent == nil {
+		varDrop, err := stringList(p.VarMap.Value(VarDropOptional))
+		if err != nil {
+			return fmt.Errorf("%s: %w", VarDropOptional, err)
+		}
+		selection = append(selection, varDrop...)
+	}
+	var errs []error
+	for _, sel := range selection {
+		if !slices.Contains(p.optional, sel) {
+			errs = append(errs, fmt.Errorf("%s is not an optional affordance and can't be dropped", sel))
+			continue
+		}
+		ptr, err := fragmentToPointer(strings.TrimPrefix(sel, "#"))
+		if err == nil {
+			err = removePointer(p.data, ptr)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to drop %s: %w", sel, err))
+			continue
+		}
+		slog.Info("drop optional affordance", "pointer", sel)
+	}
+	return errors.Join(errs...)
+}
+
+// stringList converts a single string or an array of strings
+func stringList(val any) ([]string, error) {
+	res := make([]string, 0)
+	for _, v := range asArray(val) {
+		s, isString := v.(string)
+		if !isString {
+			return nil, fmt.Errorf("invalid entry '%v', expected a string", v)
+		}
+		res = append(res, s)
+	}
+	return res, nil
+}
+
+// renamePointer translates pointers like "#/properties/on" of a submodel
+// into the names used after copying the sections with the instance prefix.
+func renamePointer(ptr string, prefix string, sections []string) string {
+	for _, section := range sections {
+		sectionPrefix := "#/" + section + "/"
+		if strings.HasPrefix(ptr, sectionPrefix) {
+			return sectionPrefix + prefix + strings.TrimPrefix(ptr, sectionPrefix)
+		}
+	}
+	return ptr
+}
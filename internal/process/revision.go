@@ -0,0 +1,190 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Revision is the tree of a git revision extracted into a temporary
+// directory, so models can be built as they were at that revision
+type Revision struct {
+	Name string
+	// top level directory of the work tree
+	root string
+	dir  string
+}
+
+// CheckoutRevision extracts the revision rev of the git repository
+// containing the directory dir. The revision must be closed to remove
+// the extracted files.
+func CheckoutRevision(dir string, rev string) (*Revision, error) {
+	out, err := git(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	root := strings.TrimSpace(string(out))
+	archive, err := git(root, "archive", "--format=tar", rev)
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := os.MkdirTemp("", "tmtd-rev-")
+	if err != nil {
+		return nil, err
+	}
+	r := &Revision{Name: rev, root: root, dir: tmp}
+	if err = extractTar(bytes.NewReader(archive), tmp); err != nil {
+		r.Close()
+		return nil, fmt.Errorf("extract revision %s: %w", rev, err)
+	}
+	return r, nil
+}
+
+func git(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return out, nil
+}
+
+// extractTar writes the regular files and directories of the archive
+// to dir, other entries like links are skipped
+func extractTar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.FromSlash(h.Name)
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("invalid file name %s", h.Name)
+		}
+		target := filepath.Join(dir, name)
+		switch h.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0o755)
+		case tar.TypeReg:
+			err = extractFile(tr, target)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func extractFile(r io.Reader, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Path maps a file of the work tree lexically to the file of the
+// revision, the file need not exist in the work tree, e.g. if it was
+// renamed or deleted since. Remote locations and files outside of the
+// work tree are not changed, neither are names found in neither tree,
+// which may be found in the search path.
+func (r *Revision) Path(location string) string {
+	if location == "" || isRemote(location) {
+		return location
+	}
+	abs, err := filepath.Abs(location)
+	if err != nil {
+		return location
+	}
+	rel, err := filepath.Rel(r.root, realPath(abs))
+	if err != nil || !filepath.IsLocal(rel) {
+		return location
+	}
+	mapped := filepath.Join(r.dir, rel)
+	if !exists(mapped) && !exists(location) {
+		return location
+	}
+	return mapped
+}
+
+func exists(location string) bool {
+	_, err := os.Stat(location)
+	return err == nil
+}
+
+// WorkTreePath maps a file of the revision back to the work tree
+func (r *Revision) WorkTreePath(location string) string {
+	rel, err := filepath.Rel(r.dir, location)
+	if err != nil || !filepath.IsLocal(rel) {
+		return location
+	}
+	return filepath.Join(r.root, rel)
+}
+
+// SearchPath maps the directories of a comma separated search path, an
+// empty search path is the current directory
+func (r *Revision) SearchPath(searchPath string) string {
+	dirs := strings.Split(searchPath, ",")
+	for i, dir := range dirs {
+		if dir == "" {
+			dir = "."
+		}
+		dirs[i] = r.Path(dir)
+	}
+	return strings.Join(dirs, ",")
+}
+
+// realPath resolves the symbolic links of the longest existing parent
+// of location, git reports the top level directory with resolved links
+func realPath(location string) string {
+	if resolved, err := filepath.EvalSymlinks(location); err == nil {
+		return resolved
+	}
+	parent := filepath.Dir(location)
+	if parent == location {
+		return location
+	}
+	return filepath.Join(realPath(parent), filepath.Base(location))
+}
+
+// Close removes the extracted files
+func (r *Revision) Close() error {
+	return os.RemoveAll(r.dir)
+}
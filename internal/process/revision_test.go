@@ -0,0 +1,73 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestRevisionPath maps the files of a revision, which were renamed or
+// deleted in the work tree since
+func TestRevisionPath(t *testing.T) {
+	dir := t.TempDir()
+	model := filepath.Join(dir, "model")
+	if err := os.MkdirAll(model, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"old.tm.jsonld", "deleted.tm.jsonld"} {
+		if err := os.WriteFile(filepath.Join(model, name), []byte("{}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "."},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "models"},
+	} {
+		if _, err := git(dir, args...); err != nil {
+			t.Skip(err)
+		}
+	}
+	if err := os.Rename(filepath.Join(model, "old.tm.jsonld"), filepath.Join(model, "new.tm.jsonld")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(model, "deleted.tm.jsonld")); err != nil {
+		t.Fatal(err)
+	}
+	r, err := CheckoutRevision(dir, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for _, name := range []string{"old.tm.jsonld", "deleted.tm.jsonld"} {
+		location := r.Path(filepath.Join(model, name))
+		if want := filepath.Join(r.dir, "model", name); location != want {
+			t.Errorf("got %s, want %s", location, want)
+		}
+		if _, err := os.Stat(location); err != nil {
+			t.Error(err)
+		}
+	}
+	for _, location := range []string{"", "https://example.com/a.tm.jsonld", "unknown.tm.jsonld", os.TempDir()} {
+		if got := r.Path(location); got != location {
+			t.Errorf("got %s for %s, want it unchanged", got, location)
+		}
+	}
+}
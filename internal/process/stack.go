@@ -0,0 +1,82 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// DefaultMaxDepth limits the nesting of tm:extends, tm:submodel and tm:ref
+const DefaultMaxDepth = 32
+
+// CycleError reports a model, which directly or indirectly
+// extends, contains or references itself.
+type CycleError struct {
+	Chain []string
+}
+
+func (e *CycleError) Error() string {
+	return "cycle detected: " + strings.Join(e.Chain, " → ")
+}
+
+// DepthError reports a resolution chain longer than the maximum depth.
+type DepthError struct {
+	MaxDepth int
+	Chain    []string
+}
+
+func (e *DepthError) Error() string {
+	return fmt.Sprintf("maximum depth of %d exceeded: %s", e.MaxDepth, strings.Join(e.Chain, " → "))
+}
+
+// SetMaxDepth limits the length of the chain of extended, sub- and
+// referenced models. Values < 1 select the DefaultMaxDepth.
+func (p *Processor) SetMaxDepth(maxDepth int) {
+	if maxDepth < 1 {
+		maxDepth = DefaultMaxDepth
+	}
+	p.maxDepth = maxDepth
+}
+
+// pushLocation adds the loaded model to the resolution stack inherited
+// from the referencing processor.
+func (p *Processor) pushLocation() error {
+	chain := append(slices.Clone(p.stack), p.location)
+	if slices.Contains(p.stack, p.location) {
+		return &CycleError{Chain: chain}
+	}
+	if len(chain) > p.maxDepth {
+		return &DepthError{MaxDepth: p.maxDepth, Chain: chain}
+	}
+	p.stack = chain
+	return nil
+}
+
+// pushReference extends the chain of tm:ref entries currently resolved
+// by the reference entry "location#pointer".
+func (p *Processor) pushReference(refs []string, entry string) ([]string, error) {
+	chain := append(slices.Clone(refs), entry)
+	if slices.Contains(refs, entry) {
+		return nil, &CycleError{Chain: append(slices.Clone(p.stack), chain...)}
+	}
+	if len(p.stack)+len(chain) > p.maxDepth {
+		return nil, &DepthError{MaxDepth: p.maxDepth, Chain: append(slices.Clone(p.stack), chain...)}
+	}
+	return chain, nil
+}
@@ -0,0 +1,135 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// SubmodelMode defines how tm:submodel links are turned into thing descriptions
+type SubmodelMode string
+
+const (
+	// SubmodelFlatten copies the affordances of submodels with an instance prefix into the parent TD
+	SubmodelFlatten SubmodelMode = "flatten"
+	// SubmodelLink creates a TD per submodel, linked to the parent TD with rel "item"
+	SubmodelLink SubmodelMode = "link"
+)
+
+const tdContentType = "application/td+json"
+
+// formatExtensions are the file extensions of the TD formats,
+// the first one is used for the written TDs.
+var formatExtensions = map[string][]string{
+	FormatJSON:     {".jsonld", ".json"},
+	FormatYAML:     {".yaml", ".yml"},
+	FormatCBOR:     {".cbor"},
+	FormatNTriples: {".nt"},
+	FormatTurtle:   {".ttl"},
+}
+
+// FormatExtension is the file extension of TDs written in format
+func FormatExtension(format string) string {
+	if extensions, found := formatExtensions[format]; found {
+		return extensions[0]
+	}
+	return formatExtensions[FormatJSON][0]
+}
+
+// SetSubmodelMode selects how submodels are represented in the output
+func (p *Processor) SetSubmodelMode(mode string) error {
+	switch SubmodelMode(mode) {
+	case SubmodelFlatten, SubmodelLink:
+		p.submodelMode = SubmodelMode(mode)
+		return nil
+	case "":
+		p.submodelMode = SubmodelFlatten
+		return nil
+	}
+	return fmt.Errorf("unknown submodel mode '%s', use %s or %s", mode, SubmodelFlatten, SubmodelLink)
+}
+
+// outputName is the filename of the TD created by this processor.
+// TDs of linked submodels are named after the parent TD and the instance,
+// e.g. floor-lamp-1.0.0.Spot1.td.jsonld
+func (p *Processor) outputName() string {
+	if p.parent == nil {
+		if p.output != "" {
+			return p.output
+		}
+		name := strings.Replace(baseName(p.filename), ".tm.", ".td.", 1)
+		// the extension follows the format of the TD
+		ext := filepath.Ext(name)
+		for format, extensions := range formatExtensions {
+			if format != p.format && slices.Contains(extensions, ext) {
+				name = strings.TrimSuffix(name, ext) + formatExtensions[p.format][0]
+			}
+		}
+		return name
+	}
+	parentName := p.parent.outputName()
+	pos := strings.LastIndex(parentName, ".td.")
+	if pos < 0 {
+		pos = len(parentName) - len(filepath.Ext(parentName))
+	}
+	return parentName[:pos] + "." + p.instance.String() + parentName[pos:]
+}
+
+// linkItems connects the TDs of the submodels with the TD of this
+// processor by "item" and "collection" links and assigns an id to
+// every submodel TD without one.
+func (p *Processor) linkItems() {
+	parentMap := p.data.(*Object)
+	seed := p.outputName()
+	if id, ok := parentMap.Value("id").(string); ok {
+		seed = id
+	}
+	for _, item := range p.items {
+		itemMap := item.data.(*Object)
+		if !itemMap.Has("id") {
+			itemMap.Set("id", "urn:uuid:"+nameBasedUUID(seed+"#"+item.instance.String()))
+		}
+		item.appendLink(Link{Rel: "collection", Href: p.outputName(), Type: tdContentType})
+		p.appendLink(Link{Rel: "item", Href: item.outputName(), Type: tdContentType})
+		item.linkItems()
+	}
+}
+
+// adoptItems takes over the submodels of an extended model
+func (p *Processor) adoptItems(from *Processor) {
+	for _, item := range from.items {
+		item.parent = p
+		p.items = append(p.items, item)
+	}
+}
+
+// nameBasedUUID creates a version 5 UUID (RFC 4122) in the URL namespace,
+// so the same name always gets the same id.
+func nameBasedUUID(name string) string {
+	namespaceURL := []byte{0x6b, 0xa7, 0xb8, 0x11, 0x9d, 0xad, 0x11, 0xd1, 0x80, 0xb4, 0x00, 0xc0, 0x4f, 0xd4, 0x30, 0xc8}
+	h := sha1.New()
+	h.Write(namespaceURL)
+	h.Write([]byte(name))
+	u := h.Sum(nil)[:16]
+	u[6] = (u[6] & 0x0f) | 0x50
+	u[8] = (u[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
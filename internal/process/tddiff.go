@@ -0,0 +1,498 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+const (
+	DiffFormatText = "text"
+	DiffFormatJSON = "json"
+)
+
+// A change of a TD is breaking, if a consumer of the old TD may fail
+// with the new one. Whether a schema change is breaking depends on the
+// direction of the data: the consumer fails, if the values it sends
+// are no longer accepted (narrowed input), or if it receives values,
+// which were not possible before (widened output). The values of
+// properties, which are neither readOnly nor writeOnly, are both.
+
+// dataDirection tells, which changes of a schema break consumers
+type dataDirection struct {
+	// the consumer sends the data, narrowing is breaking
+	input bool
+	// the consumer receives the data, widening is breaking
+	output bool
+}
+
+var (
+	dirInput  = dataDirection{input: true}
+	dirOutput = dataDirection{output: true}
+	dirBoth   = dataDirection{input: true, output: true}
+)
+
+// informativeMembers are changes, which never break consumers
+var informativeMembers = []string{"title", "titles", "description", "descriptions", "comment",
+	"@type", "@context", "version", "created", "modified", "support", "links", "default"}
+
+// breakingMembers of the TD change how consumers reach the thing
+var breakingMembers = []string{"id", "base", "security", "securityDefinitions", "profile", "schemaDefinitions"}
+
+// affordanceMembers are handled by the comparison of affordances,
+// the other members of a property are its schema
+var affordanceMembers = []string{"forms", "uriVariables", "readOnly", "writeOnly", "observable"}
+
+// lower and upper bounds of schemas, raising a lower or lowering an
+// upper bound narrows the values
+var (
+	lowerBounds = []string{"minimum", "exclusiveMinimum", "minLength", "minItems"}
+	upperBounds = []string{"maximum", "exclusiveMaximum", "maxLength", "maxItems"}
+	// a change of these members may both narrow and widen the values
+	restrictions = []string{"pattern", "format", "contentEncoding", "contentMediaType", "multipleOf", "unit", "oneOf", "allOf", "anyOf"}
+)
+
+// tdComparison collects the changes between two TDs
+type tdComparison struct {
+	changes []Change
+}
+
+func (c *tdComparison) add(kind string, ptr string, breaking bool, oldValue any, newValue any, format string, args ...any) {
+	c.changes = append(c.changes, Change{Kind: kind, Pointer: ptr, Old: oldValue, New: newValue,
+		Breaking: breaking, Message: fmt.Sprintf(format, args...)})
+}
+
+// CompareTDs compares the affordances, their schemas and forms and the
+// top level members of two TDs and classifies the changes as breaking
+// or non-breaking.
+func CompareTDs(oldTD *Object, newTD *Object) []Change {
+	c := &tdComparison{}
+	skip := []string{"forms"}
+	for _, ao := range affordanceOperations {
+		skip = append(skip, ao.section)
+		oldAffordances, _ := oldTD.Value(ao.section).(*Object)
+		newAffordances, _ := newTD.Value(ao.section).(*Object)
+		for _, name := range oldAffordances.Keys() {
+			ptr := "/" + ao.section + "/" + escapePointerToken(name)
+			o, _ := oldAffordances.Value(name).(*Object)
+			n, found := newAffordances.Value(name).(*Object)
+			if !found {
+				c.add(ChangeRemoved, ptr, true, o, nil, "%s %s removed", ao.typ, name)
+				continue
+			}
+			c.compareAffordance(ao.typ, o, n, ptr)
+		}
+		for _, name := range newAffordances.Keys() {
+			if !oldAffordances.Has(name) {
+				c.add(ChangeAdded, "/"+ao.section+"/"+escapePointerToken(name), false, nil, newAffordances.Value(name), "%s %s added", ao.typ, name)
+			}
+		}
+	}
+	c.compareForms(oldTD.Value("forms"), newTD.Value("forms"), nil, "")
+	c.compareMembers(oldTD, newTD, "", skip, func(key string) bool { return slices.Contains(breakingMembers, key) })
+	return c.changes
+}
+
+// compareMembers reports a change per changed member, which is not skipped
+func (c *tdComparison) compareMembers(o *Object, n *Object, ptr string, skip []string, breaking func(key string) bool) {
+	for _, key := range unionKeys(o, n) {
+		if slices.Contains(skip, key) {
+			continue
+		}
+		childPtr := ptr + "/" + escapePointerToken(key)
+		oldValue, inOld := o.Get(key)
+		newValue, inNew := n.Get(key)
+		switch {
+		case !inNew:
+			c.add(ChangeRemoved, childPtr, breaking(key), oldValue, nil, "%s removed", key)
+		case !inOld:
+			c.add(ChangeAdded, childPtr, breaking(key), nil, newValue, "%s added", key)
+		case len(DiffDocuments(oldValue, newValue)) > 0:
+			c.add(ChangeModified, childPtr, breaking(key), oldValue, newValue, "%s changed", key)
+		}
+	}
+}
+
+// unionKeys returns the member names of o followed by the new names of n
+func unionKeys(o *Object, n *Object) []string {
+	keys := o.Keys()
+	for _, key := range n.Keys() {
+		if !o.Has(key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (c *tdComparison) compareAffordance(typ string, o *Object, n *Object, ptr string) {
+	notBreaking := func(string) bool { return false }
+	switch typ {
+	case "property":
+		c.compareFlag(o, n, ptr, "readOnly", true)
+		c.compareFlag(o, n, ptr, "writeOnly", true)
+		c.compareFlag(o, n, ptr, "observable", false)
+		dir := dirBoth
+		if isReadOnly(o) && isReadOnly(n) {
+			dir = dirOutput
+		} else if isWriteOnly(o) && isWriteOnly(n) {
+			dir = dirInput
+		}
+		c.compareSchema(o, n, ptr, dir, affordanceMembers)
+		c.compareSchemaMap(o.Value("uriVariables"), n.Value("uriVariables"), ptr+"/uriVariables", dirInput)
+	case "action":
+		c.compareFlag(o, n, ptr, "safe", false)
+		c.compareFlag(o, n, ptr, "idempotent", false)
+		c.compareOptionalSchema(o, n, ptr, "input", dirInput)
+		c.compareOptionalSchema(o, n, ptr, "output", dirOutput)
+		c.compareSchemaMap(o.Value("uriVariables"), n.Value("uriVariables"), ptr+"/uriVariables", dirInput)
+		c.compareMembers(o, n, ptr, []string{"safe", "idempotent", "input", "output", "uriVariables", "forms"},
+			func(key string) bool { return key == "synchronous" })
+	case "event":
+		c.compareOptionalSchema(o, n, ptr, "data", dirOutput)
+		c.compareOptionalSchema(o, n, ptr, "dataResponse", dirInput)
+		c.compareOptionalSchema(o, n, ptr, "subscription", dirInput)
+		c.compareOptionalSchema(o, n, ptr, "cancellation", dirInput)
+		c.compareSchemaMap(o.Value("uriVariables"), n.Value("uriVariables"), ptr+"/uriVariables", dirInput)
+		c.compareMembers(o, n, ptr, []string{"data", "dataResponse", "subscription", "cancellation", "uriVariables", "forms"}, notBreaking)
+	}
+	c.compareForms(o.Value("forms"), n.Value("forms"), defaultOperations(typ, n), ptr)
+}
+
+// compareFlag reports the change of a boolean member of an affordance,
+// changing it to restricts is breaking, e.g. readOnly to true or
+// observable to false
+func (c *tdComparison) compareFlag(o *Object, n *Object, ptr string, key string, restricts bool) {
+	oldValue, _ := o.Value(key).(bool)
+	newValue, _ := n.Value(key).(bool)
+	if oldValue == newValue {
+		return
+	}
+	c.add(ChangeModified, ptr+"/"+key, newValue == restricts, oldValue, newValue, "%s %t -> %t", key, oldValue, newValue)
+}
+
+func isWriteOnly(property *Object) bool {
+	writeOnly, _ := property.Value("writeOnly").(bool)
+	return writeOnly
+}
+
+// compareOptionalSchema compares a schema member like the input of an
+// action, adding input or removing output is breaking
+func (c *tdComparison) compareOptionalSchema(o *Object, n *Object, ptr string, key string, dir dataDirection) {
+	childPtr := ptr + "/" + key
+	oldSchema, inOld := o.Value(key).(*Object)
+	newSchema, inNew := n.Value(key).(*Object)
+	switch {
+	case inOld && inNew:
+		c.compareSchema(oldSchema, newSchema, childPtr, dir, nil)
+	case inOld:
+		c.add(ChangeRemoved, childPtr, dir.output, oldSchema, nil, "%s removed", key)
+	case inNew:
+		c.add(ChangeAdded, childPtr, dir.input, nil, newSchema, "%s added", key)
+	}
+}
+
+// compareSchemaMap compares maps of schemas like uriVariables
+func (c *tdComparison) compareSchemaMap(oldMap any, newMap any, ptr string, dir dataDirection) {
+	o, _ := oldMap.(*Object)
+	n, _ := newMap.(*Object)
+	for _, name := range unionKeys(o, n) {
+		childPtr := ptr + "/" + escapePointerToken(name)
+		oldSchema, inOld := o.Value(name).(*Object)
+		newSchema, inNew := n.Value(name).(*Object)
+		switch {
+		case inOld && inNew:
+			c.compareSchema(oldSchema, newSchema, childPtr, dir, nil)
+		case inOld:
+			c.add(ChangeRemoved, childPtr, dir.output, oldSchema, nil, "%s removed", name)
+		case inNew:
+			c.add(ChangeAdded, childPtr, false, nil, newSchema, "%s added", name)
+		}
+	}
+}
+
+// compareSchema compares two data schemas, members in skip are ignored
+func (c *tdComparison) compareSchema(o *Object, n *Object, ptr string, dir dataDirection, skip []string) {
+	// narrowed values break consumers sending them, widened values consumers receiving them
+	narrowed, widened := dir.input, dir.output
+	for _, key := range unionKeys(o, n) {
+		if slices.Contains(skip, key) {
+			continue
+		}
+		childPtr := ptr + "/" + escapePointerToken(key)
+		oldValue, inOld := o.Get(key)
+		newValue, inNew := n.Get(key)
+		if inOld && inNew && len(DiffDocuments(oldValue, newValue)) == 0 {
+			continue
+		}
+		kind := ChangeModified
+		if !inOld {
+			kind = ChangeAdded
+		} else if !inNew {
+			kind = ChangeRemoved
+		}
+		switch {
+		case slices.Contains(informativeMembers, key):
+			c.add(kind, childPtr, false, oldValue, newValue, "%s %s", key, kind)
+		case key == "type" && inOld && inNew:
+			c.compareType(oldValue, newValue, childPtr, dir)
+		case key == "type":
+			// a new type narrows, removing it widens the values
+			c.add(kind, childPtr, (inNew && narrowed) || (inOld && widened), oldValue, newValue, "type %s", kind)
+		case slices.Contains(lowerBounds, key) || slices.Contains(upperBounds, key):
+			c.compareBound(key, oldValue, inOld, newValue, inNew, childPtr, dir)
+		case key == "enum":
+			c.compareEnum(oldValue, inOld, newValue, inNew, childPtr, dir)
+		case key == "required":
+			c.compareRequired(oldValue, newValue, childPtr, dir)
+		case key == "properties":
+			oldProperties, _ := oldValue.(*Object)
+			newProperties, _ := newValue.(*Object)
+			c.compareSchemaMap(oldProperties, newProperties, childPtr, dir)
+		case key == "items" && isObject(oldValue) && isObject(newValue):
+			c.compareSchema(oldValue.(*Object), newValue.(*Object), childPtr, dir, nil)
+		case key == "const":
+			// a new constant narrows, removing it widens, a changed one does both
+			breaking := (kind != ChangeRemoved && narrowed) || (kind != ChangeAdded && widened)
+			c.add(kind, childPtr, breaking, oldValue, newValue, "const %s", kind)
+		case slices.Contains(restrictions, key) || key == "items":
+			breaking := (kind != ChangeRemoved && narrowed) || (kind != ChangeAdded && widened)
+			c.add(kind, childPtr, breaking, oldValue, newValue, "%s %s", key, kind)
+		default:
+			c.add(kind, childPtr, false, oldValue, newValue, "%s %s", key, kind)
+		}
+	}
+}
+
+func isObject(v any) bool {
+	_, ok := v.(*Object)
+	return ok
+}
+
+// compareType reports a changed type, integer to number widens the values
+func (c *tdComparison) compareType(oldValue any, newValue any, ptr string, dir dataDirection) {
+	breaking := true
+	switch {
+	case oldValue == "integer" && newValue == "number":
+		breaking = dir.output
+	case oldValue == "number" && newValue == "integer":
+		breaking = dir.input
+	}
+	c.add(ChangeModified, ptr, breaking, oldValue, newValue, "type %v -> %v", oldValue, newValue)
+}
+
+func valueOrNone(v any) any {
+	if v == nil {
+		return "none"
+	}
+	return v
+}
+
+// compareBound reports a changed lower or upper bound
+func (c *tdComparison) compareBound(key string, oldValue any, inOld bool, newValue any, inNew bool, ptr string, dir dataDirection) {
+	var narrows bool
+	kind := ChangeModified
+	switch {
+	case !inOld:
+		kind, narrows = ChangeAdded, true
+	case !inNew:
+		kind, narrows = ChangeRemoved, false
+	default:
+		o, errOld := numberValue(oldValue)
+		n, errNew := numberValue(newValue)
+		if errOld != nil || errNew != nil {
+			c.add(kind, ptr, true, oldValue, newValue, "%s %v -> %v", key, oldValue, newValue)
+			return
+		}
+		narrows = n > o
+		if slices.Contains(upperBounds, key) {
+			narrows = n < o
+		}
+	}
+	effect := "widens"
+	breaking := dir.output
+	if narrows {
+		effect, breaking = "narrows", dir.input
+	}
+	c.add(kind, ptr, breaking, oldValue, newValue, "%s %v -> %v %s the values", key, valueOrNone(oldValue), valueOrNone(newValue), effect)
+}
+
+func numberValue(v any) (float64, error) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("%v is not a number", v)
+	}
+	return n.Float64()
+}
+
+// compareEnum reports removed enum values as narrowing and added ones as widening
+func (c *tdComparison) compareEnum(oldValue any, inOld bool, newValue any, inNew bool, ptr string, dir dataDirection) {
+	switch {
+	case !inOld:
+		c.add(ChangeAdded, ptr, dir.input, nil, newValue, "enum added narrows the values")
+		return
+	case !inNew:
+		c.add(ChangeRemoved, ptr, dir.output, oldValue, nil, "enum removed widens the values")
+		return
+	}
+	oldValues, _ := oldValue.([]any)
+	newValues, _ := newValue.([]any)
+	contains := func(values []any, v any) bool {
+		return slices.ContainsFunc(values, func(e any) bool { return len(DiffDocuments(e, v)) == 0 })
+	}
+	for _, v := range oldValues {
+		if !contains(newValues, v) {
+			c.add(ChangeRemoved, ptr, dir.input, v, nil, "enum value %s removed", shortValue(v))
+		}
+	}
+	for _, v := range newValues {
+		if !contains(oldValues, v) {
+			c.add(ChangeAdded, ptr, dir.output, nil, v, "enum value %s added", shortValue(v))
+		}
+	}
+}
+
+// compareRequired reports new required members as narrowing and members,
+// which are no longer required, as widening
+func (c *tdComparison) compareRequired(oldValue any, newValue any, ptr string, dir dataDirection) {
+	oldNames, _ := stringList(oldValue)
+	newNames, _ := stringList(newValue)
+	for _, name := range newNames {
+		if !slices.Contains(oldNames, name) {
+			c.add(ChangeAdded, ptr, dir.input, nil, name, "%s is required", name)
+		}
+	}
+	for _, name := range oldNames {
+		if !slices.Contains(newNames, name) {
+			c.add(ChangeRemoved, ptr, dir.output, name, nil, "%s is no longer required", name)
+		}
+	}
+}
+
+// defaultOperations are the operations of forms without op
+func defaultOperations(typ string, affordance *Object) []string {
+	switch typ {
+	case "property":
+		switch {
+		case isReadOnly(affordance):
+			return []string{"readproperty"}
+		case isWriteOnly(affordance):
+			return []string{"writeproperty"}
+		}
+		return []string{"readproperty", "writeproperty"}
+	case "action":
+		return []string{"invokeaction"}
+	case "event":
+		return []string{"subscribeevent", "unsubscribeevent"}
+	}
+	return nil
+}
+
+// formsByOperation returns the index of the first form of each operation
+func formsByOperation(forms []any, defaults []string) (map[string]int, []string) {
+	byOp := make(map[string]int)
+	var ops []string
+	for i, f := range forms {
+		form, _ := f.(*Object)
+		formOps, err := stringList(form.Value("op"))
+		if err != nil || len(formOps) == 0 {
+			formOps = defaults
+		}
+		for _, op := range formOps {
+			if _, found := byOp[op]; !found {
+				byOp[op] = i
+				ops = append(ops, op)
+			}
+		}
+	}
+	return byOp, ops
+}
+
+// compareForms compares the forms of each operation. A removed operation
+// or a changed form of an operation is breaking.
+func (c *tdComparison) compareForms(oldValue any, newValue any, defaults []string, ptr string) {
+	oldForms, _ := oldValue.([]any)
+	newForms, _ := newValue.([]any)
+	oldByOp, oldOps := formsByOperation(oldForms, defaults)
+	newByOp, newOps := formsByOperation(newForms, defaults)
+	reported := make(map[string]bool)
+	for _, op := range oldOps {
+		i, found := newByOp[op]
+		if !found {
+			c.add(ChangeRemoved, fmt.Sprintf("%s/forms/%d", ptr, oldByOp[op]), true, op, nil, "operation %s removed", op)
+			continue
+		}
+		o, _ := oldForms[oldByOp[op]].(*Object)
+		n, _ := newForms[i].(*Object)
+		for _, key := range unionKeys(o, n) {
+			childPtr := fmt.Sprintf("%s/forms/%d/%s", ptr, i, escapePointerToken(key))
+			if key == "op" || reported[childPtr] || len(DiffDocuments(o.Value(key), n.Value(key))) == 0 {
+				continue
+			}
+			reported[childPtr] = true
+			c.add(ChangeModified, childPtr, true, o.Value(key), n.Value(key), "%s of the form of %s changed", key, op)
+		}
+	}
+	for _, op := range newOps {
+		if _, found := oldByOp[op]; !found {
+			c.add(ChangeAdded, fmt.Sprintf("%s/forms/%d", ptr, newByOp[op]), false, nil, op, "operation %s added", op)
+		}
+	}
+}
+
+// HasBreakingChanges tells if one of the changes is breaking
+func HasBreakingChanges(changes []Change) bool {
+	return slices.ContainsFunc(changes, func(c Change) bool { return c.Breaking })
+}
+
+// WriteTDChanges writes the changes in the given format
+func WriteTDChanges(w io.Writer, format string, changes []Change) error {
+	switch format {
+	case DiffFormatText, "":
+		return writeTDChangesText(w, changes)
+	case DiffFormatJSON:
+		if changes == nil {
+			changes = make([]Change, 0)
+		}
+		return writeJSON(w, changes)
+	default:
+		return fmt.Errorf("unknown diff format '%s', expected one of %s, %s", format, DiffFormatText, DiffFormatJSON)
+	}
+}
+
+func writeTDChangesText(w io.Writer, changes []Change) error {
+	var b strings.Builder
+	breaking := 0
+	for _, c := range changes {
+		severity := "compatible"
+		if c.Breaking {
+			severity = "BREAKING"
+			breaking++
+		}
+		ptr := c.Pointer
+		if ptr == "" {
+			ptr = "/"
+		}
+		fmt.Fprintf(&b, "%-10s %s: %s\n", severity, ptr, c.Message)
+	}
+	fmt.Fprintf(&b, "%d breaking, %d compatible changes\n", breaking, len(changes)-breaking)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -22,22 +22,24 @@ import (
 	"log/slog"
 	"os"
 	"reflect"
+	"slices"
 	"strings"
 
 	"github.com/mattn/go-isatty"
 )
 
-// convert a Struct to a map using the tags
-// the lazy way
-func structToMap(obj interface{}) (newMap map[string]any, err error) {
+// convert a Struct to an object using the tags
+// the lazy way, the members keep the order of the fields
+func structToObject(obj interface{}) (*Object, error) {
 	data, err := json.Marshal(obj) // obj -> []byte
-
 	if err != nil {
-		return
+		return nil, err
 	}
-
-	err = json.Unmarshal(data, &newMap) // []byte > map[string]any
-	return
+	newObject, err := decodeJSON(data) // []byte > *Object
+	if err != nil {
+		return nil, err
+	}
+	return newObject.(*Object), nil
 }
 
 func indent(indent int) string {
@@ -70,3 +72,39 @@ func IsNil(val any) bool {
 	}
 	return false
 }
+
+// deepCopy duplicates a decoded json structure, so that the copy
+// can be modified without affecting the original.
+func deepCopy(val any) any {
+	switch v := val.(type) {
+	case *Object:
+		o := NewObject()
+		for _, key := range v.keys {
+			o.Set(key, deepCopy(v.values[key]))
+		}
+		return o
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for key, element := range v {
+			m[key] = deepCopy(element)
+		}
+		return m
+	case []any:
+		a := make([]any, len(v))
+		for i, element := range v {
+			a[i] = deepCopy(element)
+		}
+		return a
+	default:
+		return v
+	}
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,274 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+//go:generate go run gentmschema.go
+
+// schemaFiles are the TD 1.1 validation schema of W3C
+// (https://raw.githubusercontent.com/w3c/wot-thing-description/main/validation/td-json-schema-validation.json)
+// and the TM schema generated from it by gentmschema.go
+//
+//go:embed schema/*.json
+var schemaFiles embed.FS
+
+const (
+	tdSchemaFile = "schema/td-json-schema-validation.json"
+	tmSchemaFile = "schema/tm-json-schema-validation.json"
+)
+
+var (
+	schemaOnce sync.Once
+	tdSchema   *jsonschema.Schema
+	tmSchema   *jsonschema.Schema
+	schemaErr  error
+)
+
+// Violation is a single schema violation of a document
+type Violation struct {
+	// Pointer is the JSON pointer to the invalid value
+	Pointer string `json:"pointer"`
+	Message string `json:"message"`
+	// Source is the model file the invalid value originates from
+	Source string `json:"source,omitempty"`
+}
+
+// ValidationError lists the schema violations of a document
+type ValidationError struct {
+	Document   string
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s is not valid:", e.Document)
+	for _, v := range e.Violations {
+		ptr := v.Pointer
+		if ptr == "" {
+			ptr = "/"
+		}
+		fmt.Fprintf(&b, "\n\t%s: %s", ptr, v.Message)
+		if v.Source != "" {
+			fmt.Fprintf(&b, " (from %s)", v.Source)
+		}
+	}
+	return b.String()
+}
+
+func loadSchemas() {
+	compile := func(file string) (*jsonschema.Schema, error) {
+		content, err := schemaFiles.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		c := jsonschema.NewCompiler()
+		c.Draft = jsonschema.Draft7
+		if err := c.AddResource(file, bytes.NewReader(content)); err != nil {
+			return nil, err
+		}
+		return c.Compile(file)
+	}
+	tdSchema, schemaErr = compile(tdSchemaFile)
+	if schemaErr == nil {
+		tmSchema, schemaErr = compile(tmSchemaFile)
+	}
+}
+
+// ValidateTD checks a thing description against the TD 1.1 JSON schema
+func ValidateTD(data any) ([]Violation, error) {
+	schemaOnce.Do(loadSchemas)
+	if schemaErr != nil {
+		return nil, schemaErr
+	}
+	return violations(tdSchema.Validate(plainValue(data)))
+}
+
+// ValidateTM checks a thing model against the TM JSON schema
+func ValidateTM(data any) ([]Violation, error) {
+	schemaOnce.Do(loadSchemas)
+	if schemaErr != nil {
+		return nil, schemaErr
+	}
+	return violations(tmSchema.Validate(plainValue(data)))
+}
+
+// IsThingModel reports if the @type of a document contains tm:ThingModel
+func IsThingModel(data any) bool {
+	m, ok := data.(*Object)
+	if !ok {
+		return false
+	}
+	return slices.Contains(asArray(m.Value("@type")), any("tm:ThingModel"))
+}
+
+// ValidateFile checks a json file against the TM schema, if it is a
+// thing model, otherwise against the TD schema.
+func ValidateFile(filename string) error {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	data, err := parseContent(content, filename)
+	if err != nil {
+		return err
+	}
+	var found []Violation
+	if IsThingModel(data) {
+		found, err = ValidateTM(data)
+	} else {
+		found, err = ValidateTD(data)
+	}
+	if err != nil {
+		return err
+	}
+	if len(found) > 0 {
+		return &ValidationError{Document: filename, Violations: found}
+	}
+	return nil
+}
+
+// violations flattens the result of a schema validation to the
+// innermost causes, which describe the actual problems.
+func violations(err error) ([]Violation, error) {
+	if err == nil {
+		return nil, nil
+	}
+	var verr *jsonschema.ValidationError
+	if !errors.As(err, &verr) {
+		return nil, err
+	}
+	res := make([]Violation, 0)
+	var collect func(e *jsonschema.ValidationError)
+	collect = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) == 0 {
+			v := Violation{Pointer: e.InstanceLocation, Message: e.Message}
+			if !slices.Contains(res, v) {
+				res = append(res, v)
+			}
+			return
+		}
+		for _, c := range e.Causes {
+			collect(c)
+		}
+	}
+	collect(verr)
+	slices.SortStableFunc(res, func(a, b Violation) int { return strings.Compare(a.Pointer, b.Pointer) })
+	return res, nil
+}
+
+// Validate checks the generated thing description against the TD 1.1
+// JSON schema. Violations are reported with the model file they
+// originate from. In link mode the TDs of the submodels are checked, too.
+func (p *Processor) Validate() error {
+	found, err := ValidateTD(p.data)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	if len(found) > 0 {
+		for i := range found {
+			found[i].Source = p.origin(found[i].Pointer)
+		}
+		errs = append(errs, &ValidationError{Document: p.outputName(), Violations: found})
+	}
+	if p.submodelMode == SubmodelLink {
+		for _, item := range p.items {
+			errs = append(errs, item.Validate())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateModel checks a loaded thing model against the TM JSON schema,
+// every file is checked once per build. Like ValidateFile, documents
+// without the type tm:ThingModel are not checked.
+func (p *Processor) validateModel(source string, data any) error {
+	if !p.validateModels || !IsThingModel(data) || !p.loaded.firstValidation(source) {
+		return nil
+	}
+	found, err := ValidateTM(data)
+	if err != nil {
+		return err
+	}
+	if len(found) > 0 {
+		return &ValidationError{Document: source, Violations: found}
+	}
+	return nil
+}
+
+// recordOrigins remembers the loaded model as origin of its top level
+// members and affordances.
+func (p *Processor) recordOrigins() {
+	p.origins = make(map[string]string)
+	rootMap, ok := p.data.(*Object)
+	if !ok {
+		return
+	}
+	for _, key := range rootMap.Keys() {
+		ptr := "#/" + escapePointerToken(key)
+		p.origins[ptr] = p.location
+		if section, isMap := rootMap.Value(key).(*Object); isMap && slices.Contains(originSections, key) {
+			for _, name := range section.Keys() {
+				p.origins[ptr+"/"+escapePointerToken(name)] = p.location
+			}
+		}
+	}
+}
+
+var originSections = []string{"properties", "actions", "events", "securityDefinitions", "schemaDefinitions"}
+
+// origin finds the model file of the value at the JSON pointer ptr
+func (p *Processor) origin(ptr string) string {
+	ref := "#" + ptr
+	for {
+		if source, ok := p.origins[ref]; ok {
+			return source
+		}
+		pos := strings.LastIndex(ref, "/")
+		if pos < 0 {
+			return p.location
+		}
+		ref = ref[:pos]
+	}
+}
+
+// inheritOrigins adds the origins of an extended or copied model for
+// the members, which are not defined by this model itself. rename maps
+// the pointers to this model, an empty result skips the origin.
+func (p *Processor) inheritOrigins(origins map[string]string, rename func(string) string) {
+	for ptr, source := range origins {
+		ptr = rename(ptr)
+		if ptr == "" {
+			continue
+		}
+		if _, ok := p.origins[ptr]; !ok {
+			p.origins[ptr] = source
+		}
+	}
+}
@@ -0,0 +1,57 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"testing"
+)
+
+func TestValidateTM(t *testing.T) {
+	tests := []struct {
+		name  string
+		model string
+		valid bool
+	}{
+		{"minimal", `{"@context": "https://www.w3.org/2022/wot/td/v1.1", "@type": "tm:ThingModel"}`, true},
+		{"placeholders", `{"@context": "https://www.w3.org/2022/wot/td/v1.1", "@type": ["tm:ThingModel"],
+			"title": "{{name}}", "base": "http://{{host}}/", "id": "urn:{{id}}",
+			"properties": {"p": {"type": "integer", "maximum": "{{max}}", "readOnly": "{{ro}}", "forms": []}}}`, true},
+		{"no thing model type", `{"@context": "https://www.w3.org/2022/wot/td/v1.1", "@type": "Thing"}`, false},
+		{"no context", `{"@type": "tm:ThingModel"}`, false},
+		{"wrong type", `{"@context": "https://www.w3.org/2022/wot/td/v1.1", "@type": "tm:ThingModel",
+			"properties": {"p": {"type": "integer", "maximum": "high"}}}`, false},
+		{"unknown data type", `{"@context": "https://www.w3.org/2022/wot/td/v1.1", "@type": "tm:ThingModel",
+			"properties": {"p": {"type": "float"}}}`, false},
+		{"unknown operation", `{"@context": "https://www.w3.org/2022/wot/td/v1.1", "@type": "tm:ThingModel",
+			"properties": {"p": {"forms": [{"href": "p", "op": "readit"}]}}}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := decodeJSON([]byte(tt.model))
+			if err != nil {
+				t.Fatal(err)
+			}
+			found, err := ValidateTM(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if valid := len(found) == 0; valid != tt.valid {
+				t.Errorf("got valid %t, want %t: %v", valid, tt.valid, found)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// watchDelay collects the events of an editor saving several files
+	watchDelay = 200 * time.Millisecond
+	// maxChangeLines limits the changes printed per TD
+	maxChangeLines = 20
+)
+
+// watchedEntry is a manifest entry with the files it was built from
+// and its last TDs
+type watchedEntry struct {
+	entry ManifestEntry
+	files []string
+	// the TDs of the last build by file name
+	tds map[string]*Object
+}
+
+// watcher rebuilds the entries of a manifest when their files change
+type watcher struct {
+	fs  *fsnotify.Watcher
+	out io.Writer
+	// creates the processor with the settings of all entries, it is
+	// recreated when the placeholder map or binding template changes
+	newProcessor func() (*Processor, error)
+	template     *Processor
+	manifest     *Manifest
+	entries      []*watchedEntry
+	workers      int
+	validate     bool
+	// directories watched for changes of the files in them
+	dirs map[string]bool
+}
+
+// Watch builds the entries of the manifest and rebuilds an entry
+// whenever a file loaded for it changes until ctx is done. Changes of
+// the files loaded by the processor of newProcessor, like the
+// placeholder map, or of the manifest file rebuild all entries.
+// The changes of every rebuilt TD are written to out.
+func Watch(ctx context.Context, m *Manifest, newProcessor func() (*Processor, error), workers int, validate bool, out io.Writer) error {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer fsw.Close()
+	w := &watcher{fs: fsw, out: out, newProcessor: newProcessor, manifest: m,
+		workers: workers, validate: validate, dirs: make(map[string]bool)}
+	if w.template, err = newProcessor(); err != nil {
+		return err
+	}
+	if err = w.template.checkOutputs(m); err != nil {
+		return err
+	}
+	for _, e := range m.Entries {
+		w.entries = append(w.entries, &watchedEntry{entry: e})
+	}
+	w.build(w.entries, true)
+	w.watchFiles()
+	fmt.Fprintf(out, "watching %d files, stop with Ctrl+C\n", len(w.files()))
+
+	changed := make(map[string]bool)
+	var delay <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-fsw.Events:
+			if !ok {
+				return nil
+			}
+			if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+				continue
+			}
+			if location := filepath.Clean(event.Name); slices.Contains(w.files(), location) {
+				changed[location] = true
+				delay = time.After(watchDelay)
+			}
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return nil
+			}
+			slog.Warn("watch files", "error", err)
+		case <-delay:
+			w.rebuild(changed)
+			changed = make(map[string]bool)
+			delay = nil
+		}
+	}
+}
+
+// files returns the locations of all watched files
+func (w *watcher) files() []string {
+	files := w.template.LoadedFiles()
+	if w.manifest.location != "" {
+		files = append(files, w.manifest.location)
+	}
+	for _, e := range w.entries {
+		files = append(files, e.files...)
+	}
+	slices.Sort(files)
+	return slices.Compact(files)
+}
+
+// watchFiles watches the directories of all local files, editors often
+// replace a file instead of writing it
+func (w *watcher) watchFiles() {
+	for _, f := range w.files() {
+		dir := filepath.Dir(f)
+		if isRemote(f) || w.dirs[dir] {
+			continue
+		}
+		if err := w.fs.Add(dir); err != nil {
+			slog.Warn("watch directory", "dir", dir, "error", err)
+			continue
+		}
+		w.dirs[dir] = true
+	}
+}
+
+// rebuild reloads the manifest and the processor settings if their
+// files changed and rebuilds the affected entries
+func (w *watcher) rebuild(changed map[string]bool) {
+	names := make([]string, 0, len(changed))
+	for f := range changed {
+		names = append(names, baseName(f))
+	}
+	slices.Sort(names)
+	fmt.Fprintf(w.out, "\n%s changed %s\n", time.Now().Format(time.TimeOnly), strings.Join(names, ", "))
+
+	all := false
+	if changed[w.manifest.location] {
+		m, err := LoadManifest(w.manifest.location)
+		if err != nil {
+			fmt.Fprintf(w.out, "FAIL %s\n", err)
+			return
+		}
+		w.manifest = m
+		w.entries = reuseEntries(w.entries, m.Entries)
+		all = true
+	}
+	if slices.ContainsFunc(w.template.LoadedFiles(), func(f string) bool { return changed[f] }) {
+		template, err := w.newProcessor()
+		if err != nil {
+			fmt.Fprintf(w.out, "FAIL %s\n", err)
+			return
+		}
+		w.template = template
+		all = true
+	}
+	var affected []*watchedEntry
+	for _, e := range w.entries {
+		if all || e.files == nil || slices.ContainsFunc(e.files, func(f string) bool { return changed[f] }) {
+			affected = append(affected, e)
+		}
+	}
+	w.build(affected, false)
+	w.watchFiles()
+}
+
+// reuseEntries keeps the last TDs of the entries of a reloaded manifest
+func reuseEntries(old []*watchedEntry, entries []ManifestEntry) []*watchedEntry {
+	res := make([]*watchedEntry, 0, len(entries))
+	for _, e := range entries {
+		i := slices.IndexFunc(old, func(o *watchedEntry) bool {
+			return o.entry.Model == e.Model && o.entry.Output == e.Output
+		})
+		if i >= 0 {
+			res = append(res, &watchedEntry{entry: e, files: old[i].files, tds: old[i].tds})
+		} else {
+			res = append(res, &watchedEntry{entry: e})
+		}
+	}
+	return res
+}
+
+// build builds the entries and reports the result, after the first
+// build the changes of every TD are reported
+func (w *watcher) build(entries []*watchedEntry, first bool) {
+	m := &Manifest{location: w.manifest.location}
+	for _, e := range entries {
+		m.Entries = append(m.Entries, e.entry)
+	}
+	results, err := w.template.BuildManifest(m, w.workers, w.validate)
+	if err != nil {
+		fmt.Fprintf(w.out, "FAIL %s\n", err)
+		return
+	}
+	if first {
+		WriteBatchReport(w.out, results)
+	}
+	for i, r := range results {
+		e := entries[i]
+		if r.Err != nil {
+			// keep the files of the last build, the failed build may not have reached them
+			e.files = append(e.files, r.Files...)
+			if !first {
+				fmt.Fprintf(w.out, "FAIL %s: %s\n", e.entry, strings.ReplaceAll(r.Err.Error(), "\n", "\n\t"))
+			}
+			continue
+		}
+		e.files = r.Files
+		if !first {
+			names := make([]string, 0, len(r.TDs))
+			for name := range r.TDs {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			for _, name := range names {
+				w.reportChanges(name, e.tds[name], r.TDs[name])
+			}
+			for name := range e.tds {
+				if _, found := r.TDs[name]; !found {
+					fmt.Fprintf(w.out, "removed %s\n", name)
+				}
+			}
+		}
+		e.tds = r.TDs
+	}
+}
+
+// reportChanges writes the changes of a rebuilt TD
+func (w *watcher) reportChanges(name string, last *Object, td *Object) {
+	if last == nil {
+		fmt.Fprintf(w.out, "built %s\n", name)
+		return
+	}
+	changes := DiffDocuments(last, td)
+	if len(changes) == 0 {
+		fmt.Fprintf(w.out, "rebuilt %s, no changes\n", name)
+		return
+	}
+	fmt.Fprintf(w.out, "rebuilt %s, %d changes\n", name, len(changes))
+	for i, c := range changes {
+		if i == maxChangeLines {
+			fmt.Fprintf(w.out, "  ... %d more\n", len(changes)-i)
+			break
+		}
+		fmt.Fprintf(w.out, "  %s\n", c)
+	}
+}
@@ -0,0 +1,202 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package process
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// isYAML reports if a location references a YAML document
+func isYAML(location string) bool {
+	location, _, _ = strings.Cut(location, "?")
+	ext := strings.ToLower(path.Ext(location))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// isModelFile reports if a file found in the search path is a model
+func isModelFile(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasSuffix(name, ".jsonld") || strings.HasSuffix(name, ".tm.yaml") || strings.HasSuffix(name, ".tm.yml")
+}
+
+// decodeYAML parses content into the same document model as decodeJSON
+func decodeYAML(content []byte) (any, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind == 0 {
+		return nil, fmt.Errorf("empty document")
+	}
+	return yamlValue(&doc)
+}
+
+func yamlValue(n *yaml.Node) (any, error) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		return yamlValue(n.Content[0])
+	case yaml.AliasNode:
+		return yamlValue(n.Alias)
+	case yaml.MappingNode:
+		o := NewObject()
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			if k.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("line %d: only scalar keys are supported", k.Line)
+			}
+			value, err := yamlValue(v)
+			if err != nil {
+				return nil, err
+			}
+			o.Set(k.Value, value)
+		}
+		return o, nil
+	case yaml.SequenceNode:
+		a := make([]any, 0, len(n.Content))
+		for _, c := range n.Content {
+			value, err := yamlValue(c)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, value)
+		}
+		return a, nil
+	case yaml.ScalarNode:
+		return yamlScalar(n)
+	}
+	return nil, fmt.Errorf("line %d: unsupported yaml node", n.Line)
+}
+
+var jsonNumberPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// yamlScalar converts a scalar to the json type of its tag. Numbers
+// are kept as text, if it is a valid json number.
+func yamlScalar(n *yaml.Node) (any, error) {
+	switch n.ShortTag() {
+	case "!!null":
+		return nil, nil
+	case "!!bool":
+		var b bool
+		err := n.Decode(&b)
+		return b, err
+	case "!!int", "!!float":
+		text := strings.TrimPrefix(strings.ReplaceAll(n.Value, "_", ""), "+")
+		if jsonNumberPattern.MatchString(text) {
+			return json.Number(text), nil
+		}
+		if i, err := strconv.ParseInt(text, 0, 64); err == nil {
+			return json.Number(strconv.FormatInt(i, 10)), nil
+		}
+		var f float64
+		if err := n.Decode(&f); err != nil {
+			return nil, err
+		}
+		text = strconv.FormatFloat(f, 'g', -1, 64)
+		if !jsonNumberPattern.MatchString(text) {
+			return nil, fmt.Errorf("line %d: %s can't be represented in json", n.Line, n.Value)
+		}
+		return json.Number(text), nil
+	default:
+		return n.Value, nil
+	}
+}
+
+var yaml11Booleans = []string{"y", "yes", "n", "no", "on", "off"}
+
+// EncodeYAML returns the YAML serialization of data with the
+// same member order as the JSON serialization
+func (e *Encoder) EncodeYAML(data any) ([]byte, error) {
+	n, err := e.yamlNode(data, tdKeyOrder)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(n); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (e *Encoder) yamlNode(data any, order []string) (*yaml.Node, error) {
+	switch d := data.(type) {
+	case *Object:
+		keys := d.Keys()
+		if !e.keepOrder {
+			keys = orderedKeys(d.values, order)
+		}
+		return e.yamlMapping(d.values, keys)
+	case map[string]any:
+		return e.yamlMapping(d, orderedKeys(d, order))
+	case []any:
+		n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for i, element := range d {
+			c, err := e.yamlNode(element, nil)
+			if err != nil {
+				return nil, fmt.Errorf("%d: %w", i, err)
+			}
+			n.Content = append(n.Content, c)
+		}
+		return n, nil
+	case string:
+		n := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: d}
+		if slices.Contains(yaml11Booleans, strings.ToLower(d)) {
+			// YAML 1.1 parsers would read them as booleans
+			n.Style = yaml.DoubleQuotedStyle
+		}
+		return n, nil
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(d.String(), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: d.String()}, nil
+	case nil:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+	default:
+		n := &yaml.Node{}
+		if err := n.Encode(d); err != nil {
+			return nil, fmt.Errorf("cannot encode %T: %w", d, err)
+		}
+		return n, nil
+	}
+}
+
+func (e *Encoder) yamlMapping(m map[string]any, keys []string) (*yaml.Node, error) {
+	n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, key := range keys {
+		v, err := e.yamlNode(m[key], nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, v)
+	}
+	return n, nil
+}
@@ -0,0 +1,77 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CorsOptions configure the cross-origin requests, no origins disable CORS
+type CorsOptions struct {
+	// allowed origins, "*" allows all
+	AllowedOrigins   []string
+	AllowedHeaders   []string
+	AllowCredentials bool
+	// seconds a preflight response may be cached, 0 omits the header
+	MaxAge int
+}
+
+var corsMethods = []string{http.MethodGet, http.MethodPost, http.MethodOptions}
+
+func (c CorsOptions) allowsOrigin(origin string) bool {
+	return slices.Contains(c.AllowedOrigins, "*") || slices.Contains(c.AllowedOrigins, origin)
+}
+
+// withCors answers preflight requests and adds the CORS headers to
+// responses for allowed origins
+func withCors(h http.Handler, c CorsOptions) http.Handler {
+	if len(c.AllowedOrigins) == 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+		if origin == "" || !c.allowsOrigin(origin) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if slices.Contains(c.AllowedOrigins, "*") && !c.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		if c.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(corsMethods, ", "))
+		headers := append([]string{"Content-Type"}, c.AllowedHeaders...)
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+		if c.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(c.MaxAge))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,321 @@
+/*
+Copyright © 2024 Harald Müller <harald.mueller@evosoft.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/wot-oss/tmtd/internal/process"
+)
+
+// maxBodySize limits the size of posted models and TDs
+const maxBodySize = 10 << 20
+
+// Options configure the HTTP API
+type Options struct {
+	SearchPath string
+	// placeholder map used for all builds, request values override it
+	VarMap   string
+	Offline  bool
+	Binding  string
+	MaxDepth int
+	// path prefix of all endpoints, e.g. /api
+	ContextRoot string
+	Cors        CorsOptions
+	// exceptions of the restriction of posted models to relative hrefs
+	// of files in the search path
+	PostedHrefs process.HrefRestriction
+}
+
+// Server builds and validates thing descriptions on request
+type Server struct {
+	opts     Options
+	vars     *process.Object
+	resolver process.Resolver
+}
+
+// NewServer loads the placeholder map of the options
+func NewServer(opts Options) (*Server, error) {
+	s := &Server{opts: opts, resolver: process.NewHTTPResolver(process.DefaultCacheDir(), opts.Offline)}
+	p := s.newProcessor()
+	if err := p.SetPlaceholderMap(opts.VarMap); err != nil {
+		return nil, err
+	}
+	s.vars = p.VarMap
+	return s, nil
+}
+
+// Handler returns the handler of the endpoints below the context root
+//
+//	POST /build               build the TD of a posted model
+//	GET  /models              list the models of the search path
+//	GET  /models/{name}/td    build the TD of a model, ?var=name=value sets placeholders
+//	POST /validate            validate a posted TD or TM
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/build", s.handleBuild)
+	mux.HandleFunc("/models", s.handleModels)
+	mux.HandleFunc("/models/", s.handleModelTD)
+	mux.HandleFunc("/validate", s.handleValidate)
+	var h http.Handler = mux
+	if root := strings.TrimSuffix(s.opts.ContextRoot, "/"); root != "" {
+		if !strings.HasPrefix(root, "/") {
+			root = "/" + root
+		}
+		h = http.StripPrefix(root, h)
+	}
+	return logRequests(withCors(h, s.opts.Cors))
+}
+
+func (s *Server) newProcessor() *process.Processor {
+	p := process.NewProcessor("", s.opts.SearchPath)
+	p.SetResolver(s.resolver)
+	p.SetMaxDepth(s.opts.MaxDepth)
+	return p
+}
+
+// buildRequest is the body of POST /build
+type buildRequest struct {
+	// Model is the thing model or the name of a model of the search path
+	Model any
+	// Vars override the values of the placeholder map
+	Vars *process.Object
+}
+
+func (s *Server) handleBuild(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	doc, ok := readDocument(w, r)
+	if !ok {
+		return
+	}
+	obj, _ := doc.(*process.Object)
+	req := buildRequest{Model: obj.Value("model")}
+	if vars, found := obj.Get("vars"); found {
+		if req.Vars, ok = vars.(*process.Object); !ok {
+			writeProblem(w, http.StatusBadRequest, "vars is not an object")
+			return
+		}
+	}
+	switch m := req.Model.(type) {
+	case string:
+		path, found := process.FindModel(s.opts.SearchPath, m)
+		if !found {
+			writeProblem(w, http.StatusNotFound, fmt.Sprintf("model %s not found", m))
+			return
+		}
+		s.build(w, r, func(p *process.Processor) error { return p.Process(path) }, req.Vars)
+	case *process.Object:
+		s.build(w, r, func(p *process.Processor) error {
+			// posted models must not read arbitrary files or URLs of the server
+			p.SetHrefRestriction(&s.opts.PostedHrefs)
+			return p.ProcessData(m, "model.tm.jsonld")
+		}, req.Vars)
+	default:
+		writeProblem(w, http.StatusBadRequest, "model is missing, use a thing model or the name of a model")
+	}
+}
+
+func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, process.ListModels(s.opts.SearchPath))
+}
+
+// handleModelTD serves /models/{name}/td
+func (s *Server) handleModelTD(w http.ResponseWriter, r *http.Request) {
+	name, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/models/"), "/")
+	if name == "" || rest != "td" {
+		writeProblem(w, http.StatusNotFound, fmt.Sprintf("%s not found", r.URL.Path))
+		return
+	}
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	path, found := process.FindModel(s.opts.SearchPath, name)
+	if !found {
+		writeProblem(w, http.StatusNotFound, fmt.Sprintf("model %s not found", name))
+		return
+	}
+	vars := process.NewObject()
+	for _, v := range r.URL.Query()["var"] {
+		key, value, found := strings.Cut(v, "=")
+		if !found || key == "" {
+			writeProblem(w, http.StatusBadRequest, fmt.Sprintf("invalid var '%s', use var=name=value", v))
+			return
+		}
+		vars.Set(key, queryValue(value))
+	}
+	s.build(w, r, func(p *process.Processor) error { return p.Process(path) }, vars)
+}
+
+// queryValue keeps json values like numbers and booleans, everything
+// else is a string
+func queryValue(value string) any {
+	if v, err := process.ParseDocument([]byte(value), ""); err == nil {
+		if _, isObj := v.(*process.Object); !isObj {
+			return v
+		}
+	}
+	return value
+}
+
+// build processes a model with the request options format, jsonld
+// and validate and writes the TD
+func (s *Server) build(w http.ResponseWriter, r *http.Request, processModel func(*process.Processor) error, vars *process.Object) {
+	p := s.newProcessor()
+	p.VarMap = s.vars
+	p.AddPlaceholders(vars)
+	query := r.URL.Query()
+	err := errors.Join(p.SetFormat(query.Get("format")), p.SetJSONLD(query.Get("jsonld")), p.SetBinding(s.opts.Binding))
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	p.SetValidateModels(query.Get("validate") != "false")
+	if err := processModel(p); err != nil {
+		writeProblem(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if query.Get("validate") != "false" {
+		if err := p.Validate(); err != nil {
+			writeProblem(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+	}
+	content, err := p.Encode()
+	if err != nil {
+		writeProblem(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", p.ContentType())
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(content)
+}
+
+// validationResult is the response of POST /validate
+type validationResult struct {
+	Valid      bool                `json:"valid"`
+	Kind       string              `json:"kind"`
+	Violations []process.Violation `json:"violations,omitempty"`
+}
+
+func (s *Server) handleValidate(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	doc, ok := readDocument(w, r)
+	if !ok {
+		return
+	}
+	res := validationResult{Kind: "td"}
+	var err error
+	if process.IsThingModel(doc) {
+		res.Kind = "tm"
+		res.Violations, err = process.ValidateTM(doc)
+	} else {
+		res.Violations, err = process.ValidateTD(doc)
+	}
+	if err != nil {
+		writeProblem(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	res.Valid = len(res.Violations) == 0
+	writeJSON(w, http.StatusOK, res)
+}
+
+// readDocument reads a JSON or YAML object from the request body
+func readDocument(w http.ResponseWriter, r *http.Request) (any, bool) {
+	content, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		writeProblem(w, http.StatusRequestEntityTooLarge, err.Error())
+		return nil, false
+	}
+	name := "request.json"
+	if strings.Contains(r.Header.Get("Content-Type"), "yaml") {
+		name = "request.yaml"
+	}
+	doc, err := process.ParseDocument(content, name)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	if _, isObj := doc.(*process.Object); !isObj {
+		writeProblem(w, http.StatusBadRequest, "the body is not an object")
+		return nil, false
+	}
+	return doc, true
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeProblem(w, http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed", r.Method))
+	return false
+}
+
+// problem is an RFC 9457 problem detail
+type problem struct {
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func writeProblem(w http.ResponseWriter, status int, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(problem{Title: http.StatusText(status), Status: status, Detail: detail})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		slog.Error("write response", "error", err)
+	}
+}
+
+// statusRecorder remembers the status of a response for logging
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func logRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r)
+		slog.Info("request", "method", r.Method, "path", r.URL.Path, "status", rec.status)
+	})
+}